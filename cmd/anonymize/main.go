@@ -0,0 +1,98 @@
+// Command anonymize applies the configured IP privacy mode to the IPs already
+// stored on visits and messages. Rows are rewritten in batches, each in its
+// own transaction, so an interrupted run can simply be started again.
+//
+// In hash mode the rows are hashed with a random key made for this run and
+// never stored, so historical hashes cannot be linked to new ones.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/ramisoul84/emil-server/config"
+	"github.com/ramisoul84/emil-server/internal/domain"
+	"github.com/ramisoul84/emil-server/internal/repository"
+	"github.com/ramisoul84/emil-server/internal/storage/postgres"
+	"github.com/ramisoul84/emil-server/pkg/logger"
+	"github.com/ramisoul84/emil-server/pkg/privacy"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 1000, "rows read and updated per transaction")
+	dryRun := flag.Bool("dry-run", false, "count the rows that would change without updating them")
+	flag.Parse()
+
+	env := os.Getenv("APP_ENV")
+
+	if env == "" {
+		env = "development"
+	}
+
+	cfg, err := config.Load(env)
+	if err != nil {
+		panic("Failed to load configuration: " + err.Error())
+	}
+
+	logger.InitGlobal(cfg)
+
+	if cfg.Privacy.IPMode == privacy.ModeFull {
+		logger.Fatal().Msg("IP privacy mode is full, set PRIVACY_IP_MODE to truncate or hash")
+	}
+	if *batchSize <= 0 {
+		logger.Fatal().Int("batch", *batchSize).Msg("Batch size must be positive")
+	}
+
+	db, err := postgres.New(cfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to connect to database.")
+	}
+	defer db.Close()
+
+	repo := repository.NewPrivacyRepository(db)
+	anonymizer := privacy.NewEphemeralAnonymizer(cfg)
+	ctx := context.WithValue(context.Background(), "request_id", uuid.New().String())
+
+	for _, table := range domain.IPTables {
+		scanned, changed := 0, 0
+		var afterID int64
+
+		for {
+			rows, err := repo.ListIPs(ctx, table, afterID, *batchSize)
+			if err != nil {
+				logger.Fatal().Err(err).Str("table", table).Msg("Failed to read stored IPs")
+			}
+			if len(rows) == 0 {
+				break
+			}
+			afterID = rows[len(rows)-1].ID
+			scanned += len(rows)
+
+			var updates []*domain.StoredIP
+			for _, row := range rows {
+				if ip := anonymizer.Anonymize(row.IP); ip != row.IP {
+					row.IP = ip
+					updates = append(updates, row)
+				}
+			}
+			changed += len(updates)
+
+			if *dryRun || len(updates) == 0 {
+				continue
+			}
+			if err := repo.UpdateIPs(ctx, table, updates); err != nil {
+				logger.Fatal().Err(err).Str("table", table).Msg("Failed to anonymize stored IPs")
+			}
+		}
+
+		logger.Info().
+			Str("table", table).
+			Str("mode", cfg.Privacy.IPMode).
+			Int("scanned", scanned).
+			Int("changed", changed).
+			Bool("dry_run", *dryRun).
+			Msg("Anonymized stored IPs")
+	}
+}
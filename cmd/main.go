@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"syscall"
@@ -13,7 +14,9 @@ import (
 	"github.com/ramisoul84/emil-server/internal/service"
 	"github.com/ramisoul84/emil-server/internal/storage/postgres"
 	"github.com/ramisoul84/emil-server/pkg/jwt"
+	"github.com/ramisoul84/emil-server/pkg/location"
 	"github.com/ramisoul84/emil-server/pkg/logger"
+	"github.com/ramisoul84/emil-server/pkg/privacy"
 )
 
 func main() {
@@ -53,25 +56,63 @@ func main() {
 		logger.Fatal().Err(err).Msg("Failed to create bot")
 	}
 
+	// ==================== GeoIP ====================
+	geoDB, err := location.NewMMDB(cfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to open GeoIP database")
+	}
+
+	var geoProviders []location.Provider
+	if geoDB != nil {
+		geoProviders = append(geoProviders, geoDB)
+		logger.Info().Msg("Using local GeoIP database")
+
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go geoDB.Watch(watchCtx)
+	}
+	if cfg.GeoIP.HTTPFallback {
+		geoProviders = append(geoProviders, location.NewIPAPI())
+	}
+	if len(geoProviders) == 0 {
+		logger.Warn().Msg("No GeoIP database or HTTP fallback configured, locations will be unknown")
+	}
+	locator := location.NewLocator(cfg, geoProviders...)
+	anonymizer := privacy.NewAnonymizer(cfg)
+
 	// ====================  Repository ====================
 	analyticsRepository := repository.NewAnalyticsRepository(db)
 	messageRepository := repository.NewMessageRepository(db)
+	goalRepository := repository.NewGoalRepository(db)
 
 	// ==================== Services ====================
+	ingestPipeline := service.NewIngestPipeline(cfg)
+	ingestPipeline.Start()
+
+	liveHub := service.NewLiveHub()
+
 	botService := service.NewBotService(botServer)
-	analyticsService := service.NewAnalyticsService(analyticsRepository, botService)
+	analyticsService := service.NewAnalyticsService(cfg, analyticsRepository, messageRepository, botService, ingestPipeline, liveHub, locator, anonymizer)
 	authService := service.NewAuthService(cfg)
-	messageService := service.NewMessageService(messageRepository, botService)
+	messageService := service.NewMessageService(messageRepository, botService, locator, anonymizer)
+	goalService := service.NewGoalService(goalRepository)
 	jwt := jwt.NewJWT(cfg)
 
+	sweeperCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	go analyticsService.RunSessionSweeper(sweeperCtx)
+
 	// ==================== Handler ====================
 	analyticsHandler := handler.NewAnalyticsHandler(analyticsService)
 	authHandler := handler.NewAuthHandler(authService, jwt)
 	messageHandler := handler.NewMessageHandler(messageService)
+	goalHandler := handler.NewGoalHandler(goalService)
 
 	// ==================== HTTP Server ====================
-	srv := http.NewServer(cfg, analyticsHandler, authHandler, messageHandler)
+	srv := http.NewServer(cfg, ingestPipeline, liveHub, analyticsHandler, authHandler, messageHandler, goalHandler, anonymizer)
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
@@ -86,4 +127,6 @@ func main() {
 		logger.Fatal().Err(err).Msg("Server failed to start")
 	}
 
+	// Start returns as soon as the listener is closed, wait for the queue to drain.
+	<-shutdownDone
 }
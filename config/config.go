@@ -10,12 +10,15 @@ import (
 
 // Config holds all configuration for the API Gateway
 type Config struct {
-	App      AppConfig
-	Logging  LoggingConfig
-	Server   ServerConfig
-	Bot      TelegramBotConfig
-	Database DatabaseConfig
-	Security SecurityConfig
+	App       AppConfig
+	Logging   LoggingConfig
+	Server    ServerConfig
+	Bot       TelegramBotConfig
+	Database  DatabaseConfig
+	Security  SecurityConfig
+	Analytics AnalyticsConfig
+	GeoIP     GeoIPConfig
+	Privacy   PrivacyConfig
 }
 
 // AppConfig holds application metadata
@@ -47,6 +50,10 @@ type ServerConfig struct {
 	ExposeHeaders      []string
 	AllowCredentials   bool
 	MaxAge             int
+	// TrustedProxies are the CIDRs or addresses of the reverse proxies whose
+	// forwarding headers are believed. Only loopback is trusted by default,
+	// proxies on other networks have to be listed.
+	TrustedProxies []string
 }
 
 // TelegramBotConfig holds telegram bot configuration
@@ -78,6 +85,37 @@ type SecurityConfig struct {
 	HashedPassword       string
 }
 
+// AnalyticsConfig holds analytics ingest configuration
+type AnalyticsConfig struct {
+	IngestQueueSize      int
+	IngestWorkers        int
+	IngestJobTimeout     time.Duration
+	SessionTimeout       time.Duration
+	SessionSweepInterval time.Duration
+	ActiveWindow         time.Duration
+	BounceThreshold      time.Duration
+}
+
+// GeoIPConfig holds geolocation configuration. The local MaxMind or DB-IP
+// databases are asked first, either path may be empty. HTTPFallback, off by
+// default, lets addresses they miss go to ip-api.com.
+type GeoIPConfig struct {
+	CityDBPath     string
+	ASNDBPath      string
+	ReloadInterval time.Duration
+	HTTPFallback   bool
+	LookupTimeout  time.Duration
+	CacheSize      int
+	CacheTTL       time.Duration
+}
+
+// PrivacyConfig holds how client IPs are stored and logged: "full",
+// "truncate" or "hash". The hash mode needs a secret key.
+type PrivacyConfig struct {
+	IPMode    string
+	IPHashKey string
+}
+
 func Load(env string) (*Config, error) {
 	var envFile string
 	switch strings.ToLower(env) {
@@ -115,6 +153,7 @@ func Load(env string) (*Config, error) {
 		ExposeHeaders:      getEnvAsSlice("SERVER_CORS_EXPOSE_HEADERS", []string{"Content-Length,Set-Cookie,X-Total-Count"}, ","),
 		AllowCredentials:   getEnvAsBool("SERVER_CORS_ALLOW_CREDENTIALS", true),
 		MaxAge:             getEnvAsInt("SERVER_CORS_MAX_AGE", 86400),
+		TrustedProxies:     getEnvAsSlice("SERVER_TRUSTED_PROXIES", []string{"127.0.0.0/8", "::1/128"}, ","),
 	}
 
 	bot := TelegramBotConfig{
@@ -143,13 +182,41 @@ func Load(env string) (*Config, error) {
 		HashedPassword:       getEnv("HASHED_PASSWORD", ""),
 	}
 
+	analytics := AnalyticsConfig{
+		IngestQueueSize:      getEnvAsInt("ANALYTICS_INGEST_QUEUE_SIZE", 1000),
+		IngestWorkers:        getEnvAsInt("ANALYTICS_INGEST_WORKERS", 4),
+		IngestJobTimeout:     getEnvAsDuration("ANALYTICS_INGEST_JOB_TIMEOUT", 30*time.Second),
+		SessionTimeout:       getEnvAsDuration("ANALYTICS_SESSION_TIMEOUT", 5*time.Minute),
+		SessionSweepInterval: getEnvAsDuration("ANALYTICS_SESSION_SWEEP_INTERVAL", 1*time.Minute),
+		ActiveWindow:         getEnvAsDuration("ANALYTICS_ACTIVE_WINDOW", 5*time.Minute),
+		BounceThreshold:      getEnvAsDuration("ANALYTICS_BOUNCE_THRESHOLD", 10*time.Second),
+	}
+
+	geoIP := GeoIPConfig{
+		CityDBPath:     getEnv("GEOIP_CITY_DB", ""),
+		ASNDBPath:      getEnv("GEOIP_ASN_DB", ""),
+		ReloadInterval: getEnvAsDuration("GEOIP_RELOAD_INTERVAL", 1*time.Minute),
+		HTTPFallback:   getEnvAsBool("GEOIP_HTTP_FALLBACK", false),
+		LookupTimeout:  getEnvAsDuration("GEOIP_LOOKUP_TIMEOUT", 2*time.Second),
+		CacheSize:      getEnvAsInt("GEOIP_CACHE_SIZE", 10000),
+		CacheTTL:       getEnvAsDuration("GEOIP_CACHE_TTL", 24*time.Hour),
+	}
+
+	privacy := PrivacyConfig{
+		IPMode:    strings.ToLower(getEnv("PRIVACY_IP_MODE", "full")),
+		IPHashKey: getEnv("PRIVACY_IP_HASH_KEY", ""),
+	}
+
 	cfg := &Config{
-		App:      app,
-		Logging:  logging,
-		Server:   server,
-		Bot:      bot,
-		Database: database,
-		Security: security,
+		App:       app,
+		Logging:   logging,
+		Server:    server,
+		Bot:       bot,
+		Database:  database,
+		Security:  security,
+		Analytics: analytics,
+		GeoIP:     geoIP,
+		Privacy:   privacy,
 	}
 
 	if err := validateConfig(cfg); err != nil {
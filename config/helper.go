@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -73,6 +75,38 @@ func validateConfig(cfg *Config) error {
 	if cfg.Database.Password == "" {
 		return fmt.Errorf("Database password must be set")
 	}
+	if cfg.Analytics.IngestQueueSize <= 0 || cfg.Analytics.IngestWorkers <= 0 {
+		return fmt.Errorf("analytics ingest queue size and workers must be positive")
+	}
+	if cfg.Analytics.SessionTimeout <= 0 || cfg.Analytics.SessionSweepInterval <= 0 {
+		return fmt.Errorf("analytics session timeout and sweep interval must be positive")
+	}
+	for _, proxy := range cfg.Server.TrustedProxies {
+		if !validProxy(proxy) {
+			return fmt.Errorf("trusted proxy %q must be an IP address or CIDR", proxy)
+		}
+	}
+	if (cfg.GeoIP.CityDBPath != "" || cfg.GeoIP.ASNDBPath != "") && cfg.GeoIP.ReloadInterval <= 0 {
+		return fmt.Errorf("GeoIP reload interval must be positive")
+	}
+	if cfg.GeoIP.LookupTimeout <= 0 || cfg.GeoIP.CacheTTL <= 0 {
+		return fmt.Errorf("GeoIP lookup timeout and cache TTL must be positive")
+	}
+	if !slices.Contains([]string{"full", "truncate", "hash"}, cfg.Privacy.IPMode) {
+		return fmt.Errorf("IP privacy mode must be one of full, truncate, hash")
+	}
+	if cfg.Privacy.IPMode == "hash" && cfg.Privacy.IPHashKey == "" {
+		return fmt.Errorf("IP hash key must be set for the hash privacy mode")
+	}
 
 	return nil
 }
+
+func validProxy(proxy string) bool {
+	proxy = strings.TrimSpace(proxy)
+	if _, err := netip.ParsePrefix(proxy); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(proxy)
+	return err == nil
+}
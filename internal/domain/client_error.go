@@ -0,0 +1,50 @@
+package domain
+
+import "time"
+
+// ClientErrorData is a JavaScript error reported by the frontend.
+type ClientErrorData struct {
+	SessionID string `json:"session_id"`
+	URL       string `json:"url"`
+	Message   string `json:"message"`
+	Stack     string `json:"stack"`
+	Source    string `json:"source"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	UserAgent string `json:"user_agent"`
+}
+
+// ErrorGroup collects the occurrences of errors with the same fingerprint.
+type ErrorGroup struct {
+	ID          int64     `json:"id" db:"id"`
+	Fingerprint string    `json:"fingerprint" db:"fingerprint"`
+	Message     string    `json:"message" db:"message"`
+	Source      string    `json:"source" db:"source"`
+	Line        int       `json:"line" db:"line"`
+	Column      int       `json:"column" db:"col"`
+	FirstSeen   time.Time `json:"first_seen" db:"first_seen"`
+	LastSeen    time.Time `json:"last_seen" db:"last_seen"`
+	Count       int64     `json:"count" db:"count"`
+}
+
+type ErrorOccurrence struct {
+	ID        int64     `json:"id" db:"id"`
+	GroupID   int64     `json:"group_id" db:"group_id"`
+	SessionID string    `json:"session_id" db:"session_id"`
+	Path      string    `json:"path" db:"path"`
+	Message   string    `json:"message" db:"message"`
+	Stack     string    `json:"stack" db:"stack"`
+	Source    string    `json:"source" db:"source"`
+	Line      int       `json:"line" db:"line"`
+	Column    int       `json:"column" db:"col"`
+	Browser   string    `json:"browser" db:"browser"`
+	OS        string    `json:"os" db:"os"`
+	Country   string    `json:"country" db:"country"`
+	City      string    `json:"city" db:"city"`
+	Time      time.Time `json:"time" db:"time"`
+}
+
+type ErrorGroupDetail struct {
+	ErrorGroup
+	Occurrences []*ErrorOccurrence `json:"occurrences"`
+}
@@ -18,3 +18,14 @@ var (
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 )
+
+// Ingest Errors
+var (
+	ErrQueueFull    = errors.New("ingest queue is full")
+	ErrShuttingDown = errors.New("shutting down")
+)
+
+// Validation Errors
+var (
+	ErrValidation = errors.New("validation error")
+)
@@ -0,0 +1,82 @@
+package domain
+
+import "time"
+
+// Event names with a dedicated meaning
+const (
+	// EventPageview is a page or SPA route view, with "path" and "title" properties.
+	EventPageview = "pageview"
+	// EventOutbound is a click on a link to another site and EventDownload a
+	// click on a file, both with a "url" property and an optional "path" of
+	// the page the link is on.
+	EventOutbound = "outbound"
+	EventDownload = "download"
+)
+
+type Event struct {
+	ID         int64          `json:"id" db:"id"`
+	SessionID  string         `json:"session_id" db:"session_id"`
+	Name       string         `json:"name" db:"name"`
+	Properties map[string]any `json:"properties"`
+	Timestamp  time.Time      `json:"timestamp" db:"time"`
+}
+
+type EventFilter struct {
+	SessionID string
+	UserID    string
+	Name      string
+	Limit     int
+	Offset    int
+}
+
+// BatchResult reports the outcome of a batched ingest request.
+type BatchResult struct {
+	Accepted int          `json:"accepted"`
+	Rejected int          `json:"rejected"`
+	Errors   []BatchError `json:"errors,omitempty"`
+}
+
+type BatchError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type PageItem struct {
+	Path           string  `json:"path" db:"path"`
+	Views          int     `json:"views" db:"views"`
+	UniqueVisitors int     `json:"unique_visitors" db:"unique_visitors"`
+	AvgTimeOnPage  float64 `json:"avg_time_on_page" db:"avg_time_on_page"`
+	Exits          int     `json:"exits" db:"exits"`
+	ExitRate       float64 `json:"exit_rate" db:"exit_rate"`
+}
+
+type DestinationItem struct {
+	Host     string `json:"host" db:"host"`
+	Clicks   int    `json:"clicks" db:"clicks"`
+	Visitors int    `json:"visitors" db:"visitors"`
+}
+
+type LinkItem struct {
+	URL      string `json:"url" db:"url"`
+	Clicks   int    `json:"clicks" db:"clicks"`
+	Visitors int    `json:"visitors" db:"visitors"`
+}
+
+type DownloadBucket struct {
+	Time      time.Time `json:"time" db:"bucket"`
+	URL       string    `json:"url" db:"url"`
+	Downloads int       `json:"downloads" db:"downloads"`
+}
+
+// LinksReport covers outbound links and downloads: the most clicked
+// destinations and files, and downloads of the top files per interval bucket.
+type LinksReport struct {
+	From           time.Time          `json:"from"`
+	To             time.Time          `json:"to"`
+	Interval       string             `json:"interval"`
+	Timezone       string             `json:"timezone"`
+	Destinations   []*DestinationItem `json:"destinations"`
+	OutboundLinks  []*LinkItem        `json:"outbound_links"`
+	Downloads      []*LinkItem        `json:"downloads"`
+	DownloadSeries []*DownloadBucket  `json:"download_series"`
+}
@@ -0,0 +1,15 @@
+package domain
+
+// GeoInfo is the location and network of the IP a visit or message came
+// from, beyond country and city. Coordinates are nil when unknown.
+type GeoInfo struct {
+	CountryCode string   `json:"country_code" db:"country_code"` // ISO 3166-1 alpha-2
+	Region      string   `json:"region" db:"region"`
+	Latitude    *float64 `json:"latitude" db:"latitude"`
+	Longitude   *float64 `json:"longitude" db:"longitude"`
+	// GeoTimezone is the IANA timezone of the location, unlike Device.Timezone
+	// which the browser reports.
+	GeoTimezone string `json:"geo_timezone" db:"geo_timezone"`
+	ASN         int    `json:"asn" db:"asn"`
+	ISP         string `json:"isp" db:"isp"`
+}
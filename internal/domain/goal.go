@@ -0,0 +1,41 @@
+package domain
+
+import "time"
+
+// Goal types, i.e. what a goal's Match is compared against. Message goals
+// match sessions in which the visitor sent a contact message and have no Match.
+const (
+	GoalTypeAction   = "action"
+	GoalTypeEvent    = "event"
+	GoalTypePageview = "pageview"
+	GoalTypeMessage  = "message"
+)
+
+var GoalTypes = []string{GoalTypeAction, GoalTypeEvent, GoalTypePageview, GoalTypeMessage}
+
+type Goal struct {
+	ID        int       `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Type      string    `json:"type" db:"type"`
+	Match     string    `json:"match" db:"match"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// FunnelStep counts the sessions that completed a funnel step after all the
+// steps before it, in order.
+type FunnelStep struct {
+	Goal     *Goal `json:"goal"`
+	Sessions int   `json:"sessions"`
+	// Conversion is the share of the previous step's sessions that reached this step.
+	Conversion float64 `json:"conversion"`
+	// OverallConversion is the share of all sessions in range that reached this step.
+	OverallConversion float64 `json:"overall_conversion"`
+	DropOff           int     `json:"drop_off"`
+}
+
+type FunnelReport struct {
+	From          time.Time     `json:"from"`
+	To            time.Time     `json:"to"`
+	TotalSessions int           `json:"total_sessions"`
+	Steps         []*FunnelStep `json:"steps"`
+}
@@ -0,0 +1,105 @@
+package domain
+
+import "time"
+
+// InteractionData is what the browser reports about one page view when it
+// ends: where the visitor clicked and how far they scrolled. Coordinates and
+// sizes are CSS pixels, click coordinates relative to the document.
+type InteractionData struct {
+	SessionID      string   `json:"session_id"`
+	URL            string   `json:"url"`
+	UserAgent      string   `json:"user_agent"`
+	ViewportWidth  int      `json:"viewport_width"`
+	ViewportHeight int      `json:"viewport_height"`
+	PageHeight     int      `json:"page_height"`
+	MaxScroll      int      `json:"max_scroll"`
+	Clicks         []*Click `json:"clicks"`
+}
+
+type Click struct {
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Selector string `json:"selector"`
+}
+
+// ClickSample is a stored click. X is relative to the viewport width, since
+// layouts reflow horizontally, and Y to the page height, both from 0 to 1.
+type ClickSample struct {
+	SessionID  string
+	Path       string
+	X          float64
+	Y          float64
+	Selector   string
+	DeviceType string
+	Time       time.Time
+}
+
+// ScrollSample is the share of the page, from 0 to 100, that a page view
+// brought into the viewport.
+type ScrollSample struct {
+	SessionID  string
+	Path       string
+	Depth      float64
+	DeviceType string
+	Time       time.Time
+}
+
+// HeatmapFilter restricts the heatmap report to a page and device class and
+// sets the number of grid cells per axis.
+type HeatmapFilter struct {
+	AnalyticsFilter
+	Path       string
+	DeviceType string
+	Grid       int
+	Limit      int
+}
+
+type HeatmapCell struct {
+	Path   string `json:"-" db:"path"`
+	X      int    `json:"x" db:"x"`
+	Y      int    `json:"y" db:"y"`
+	Clicks int    `json:"clicks" db:"clicks"`
+}
+
+type SelectorCount struct {
+	Path     string `json:"-" db:"path"`
+	Selector string `json:"selector" db:"selector"`
+	Clicks   int    `json:"clicks" db:"clicks"`
+}
+
+// ScrollReach is how many page views scrolled at least Depth percent down.
+type ScrollReach struct {
+	Depth     int     `json:"depth"`
+	Pageviews int     `json:"pageviews"`
+	Share     float64 `json:"share"`
+}
+
+type ScrollDepth struct {
+	Path       string         `json:"-" db:"path"`
+	Pageviews  int            `json:"pageviews" db:"pageviews"`
+	P25        float64        `json:"p25" db:"p25"`
+	P50        float64        `json:"p50" db:"p50"`
+	P75        float64        `json:"p75" db:"p75"`
+	P90        float64        `json:"p90" db:"p90"`
+	Reached25  int            `json:"-" db:"reached_25"`
+	Reached50  int            `json:"-" db:"reached_50"`
+	Reached75  int            `json:"-" db:"reached_75"`
+	Reached100 int            `json:"-" db:"reached_100"`
+	Reach      []*ScrollReach `json:"reach" db:"-"`
+}
+
+type HeatmapPage struct {
+	Path      string           `json:"path"`
+	Clicks    int              `json:"clicks"`
+	Cells     []*HeatmapCell   `json:"cells"`
+	Selectors []*SelectorCount `json:"selectors"`
+	Scroll    *ScrollDepth     `json:"scroll"`
+}
+
+type HeatmapReport struct {
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Timezone string         `json:"timezone"`
+	Grid     int            `json:"grid"`
+	Pages    []*HeatmapPage `json:"pages"`
+}
@@ -13,4 +13,5 @@ type Message struct {
 	IP      string    `json:"ip"`
 	City    string    `json:"city" db:"city"`
 	Country string    `json:"country" db:"country"`
+	GeoInfo
 }
@@ -0,0 +1,16 @@
+package domain
+
+// Tables whose rows keep the IP of the client they came from.
+const (
+	IPTableVisits   = "visits"
+	IPTableMessages = "messages"
+)
+
+// IPTables lists the tables that store client IPs.
+var IPTables = []string{IPTableVisits, IPTableMessages}
+
+// StoredIP is the IP persisted on a visit or message row.
+type StoredIP struct {
+	ID int64  `db:"id"`
+	IP string `db:"ip"`
+}
@@ -1,10 +1,21 @@
 package domain
 
+import "time"
+
 type VisitStartData struct {
 	SessionID string `json:"session_id"`
 	UserID    string `json:"user_id"`
 	Referrer  string `json:"referrer"`
 	UserAgent string `json:"user_agent"`
+	// URL is the landing page URL, including any utm_* parameters.
+	URL string `json:"url"`
+	// Screen, viewport, language and timezone as reported by the browser.
+	ScreenWidth    int    `json:"screen_width"`
+	ScreenHeight   int    `json:"screen_height"`
+	ViewportWidth  int    `json:"viewport_width"`
+	ViewportHeight int    `json:"viewport_height"`
+	Language       string `json:"language"`
+	Timezone       string `json:"timezone"`
 }
 
 type VisitData struct {
@@ -12,9 +23,20 @@ type VisitData struct {
 	UserID    string         `json:"user_id"`
 	Referrer  string         `json:"referrer"`
 	UserAgent string         `json:"user_agent"`
+	URL       string         `json:"url"`
 	StartTime string         `json:"start_time"`
 	Duration  float64        `json:"duration"`
 	Actions   map[string]int `json:"actions"`
+	// ActionAges holds, by action name, how many seconds before this report
+	// the action was first taken.
+	ActionAges map[string]float64 `json:"action_ages"`
+}
+
+type HeartbeatData struct {
+	SessionID  string             `json:"session_id"`
+	Duration   float64            `json:"duration"`
+	Actions    map[string]int     `json:"actions"`
+	ActionAges map[string]float64 `json:"action_ages"`
 }
 
 type Data struct {
@@ -25,16 +47,298 @@ type Data struct {
 	Country        string  `json:"country"`
 	City           string  `json:"city"`
 	OS             string  `json:"os"`
+	Browser        string  `json:"browser"`
 	StartTime      string  `json:"start_time" db:"start_time"`
 	Duration       float64 `json:"duration"`
 	ActiveDuration float64 `json:"active_duration" db:"active_duration"`
 	ActionsCount   int     `json:"actions_count" db:"actions_count"`
+	LandingPage    string  `json:"landing_page" db:"landing_page"`
+	ExitPage       string  `json:"exit_page" db:"exit_page"`
+	// Actions holds the action counts by name, stored in visit_actions.
+	Actions map[string]int `json:"actions,omitempty" db:"-"`
+	// ActionsFirstSeen holds when each action was first taken, where known.
+	ActionsFirstSeen map[string]time.Time `json:"-" db:"-"`
+	IsBot            bool                 `json:"is_bot" db:"is_bot"`
+	BotReason        string               `json:"bot_reason,omitempty" db:"bot_reason"`
+	Attribution
+	Device
+	GeoInfo
+}
+
+// Device classes
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+)
+
+// Device describes the browser and screen of a visit. Versions, class and
+// engine come from the user-agent, the rest is reported by the browser.
+type Device struct {
+	BrowserVersion string `json:"browser_version" db:"browser_version"`
+	OSVersion      string `json:"os_version" db:"os_version"`
+	DeviceType     string `json:"device_type" db:"device_type"`
+	Engine         string `json:"engine" db:"engine"`
+	ScreenWidth    int    `json:"screen_width" db:"screen_width"`
+	ScreenHeight   int    `json:"screen_height" db:"screen_height"`
+	ViewportWidth  int    `json:"viewport_width" db:"viewport_width"`
+	ViewportHeight int    `json:"viewport_height" db:"viewport_height"`
+	Language       string `json:"language" db:"language"`
+	Timezone       string `json:"timezone" db:"timezone"`
+}
+
+// Reasons a visit was classified as a bot
+const (
+	BotReasonUserAgent    = "user_agent"
+	BotReasonDatacenter   = "datacenter"
+	BotReasonZeroDuration = "zero_duration"
+	BotReasonActionRate   = "action_rate"
+)
+
+// Traffic channels
+const (
+	ChannelDirect   = "direct"
+	ChannelSearch   = "search"
+	ChannelSocial   = "social"
+	ChannelEmail    = "email"
+	ChannelPaid     = "paid"
+	ChannelCampaign = "campaign"
+	ChannelReferral = "referral"
+)
+
+// Attribution describes where a visit came from.
+type Attribution struct {
+	Referrer     string `json:"referrer"`
+	ReferrerHost string `json:"referrer_host" db:"referrer_host"`
+	Channel      string `json:"channel"`
+	Source       string `json:"source"` // named engine or site, e.g. Google or LinkedIn
+	UTMSource    string `json:"utm_source" db:"utm_source"`
+	UTMMedium    string `json:"utm_medium" db:"utm_medium"`
+	UTMCampaign  string `json:"utm_campaign" db:"utm_campaign"`
+	UTMTerm      string `json:"utm_term" db:"utm_term"`
+	UTMContent   string `json:"utm_content" db:"utm_content"`
 }
 
 type Stats struct {
-	TotalVisits       int     `json:"total_visits" db:"total_visits"`
+	TotalVisits          int     `json:"total_visits" db:"total_visits"`
+	UniqueUsers          int     `json:"unique_users" db:"unique_users"`
+	AvgDuration          float64 `json:"avg_duration" db:"avg_duration"`
+	AvgActiveDuration    float64 `json:"avg_active_duration" db:"avg_active_duration"`
+	MedianActiveDuration float64 `json:"median_active_duration" db:"median_active_duration"`
+	P90ActiveDuration    float64 `json:"p90_active_duration" db:"p90_active_duration"`
+	AvgActions           float64 `json:"avg_actions" db:"avg_actions"`
+	PagesPerSession      float64 `json:"pages_per_session" db:"pages_per_session"`
+	// BounceRate is the share of finished visits with at most one page and
+	// either no actions or less active time than the bounce threshold.
+	BounceRate float64 `json:"bounce_rate" db:"bounce_rate"`
+	// ReturningRatio is the share of visits whose user_id was seen before.
+	ReturningRatio float64 `json:"returning_ratio" db:"returning_ratio"`
+}
+
+// Stats bucket intervals
+const (
+	IntervalHour  = "hour"
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// AnalyticsFilter restricts analytics reports to visits started in [From, To).
+// Interval and Timezone control how time series are bucketed.
+type AnalyticsFilter struct {
+	From     time.Time
+	To       time.Time
+	Interval string
+	Timezone string
+	// Filters restricts visits to the given value per breakdown dimension.
+	Filters map[string]string
+	// BounceThreshold is the active time in seconds below which a single
+	// page visit counts as a bounce.
+	BounceThreshold float64
+	// IncludeBots also reports visits classified as bots.
+	IncludeBots bool
+}
+
+// Breakdown dimensions
+const (
+	DimensionCountry   = "country"
+	DimensionCity      = "city"
+	DimensionOS        = "os"
+	DimensionBrowser   = "browser"
+	DimensionReferrer  = "referrer"
+	DimensionChannel   = "channel"
+	DimensionSource    = "source"
+	DimensionCampaign  = "utm_campaign"
+	DimensionMedium    = "utm_medium"
+	DimensionUTMSource = "utm_source"
+	DimensionLanding   = "landing_page"
+	DimensionExit      = "exit_page"
+	DimensionBotReason = "bot_reason"
+
+	DimensionDeviceType     = "device_type"
+	DimensionBrowserVersion = "browser_version"
+	DimensionOSVersion      = "os_version"
+	DimensionEngine         = "engine"
+	DimensionScreen         = "screen"
+	DimensionViewport       = "viewport"
+	DimensionLanguage       = "language"
+	DimensionTimezone       = "timezone"
+
+	DimensionCountryCode = "country_code"
+	DimensionRegion      = "region"
+	DimensionASN         = "asn"
+)
+
+var BreakdownDimensions = []string{
+	DimensionCountry,
+	DimensionCity,
+	DimensionOS,
+	DimensionBrowser,
+	DimensionReferrer,
+	DimensionChannel,
+	DimensionSource,
+	DimensionUTMSource,
+	DimensionMedium,
+	DimensionCampaign,
+	DimensionLanding,
+	DimensionExit,
+	DimensionBotReason,
+	DimensionDeviceType,
+	DimensionBrowserVersion,
+	DimensionOSVersion,
+	DimensionEngine,
+	DimensionScreen,
+	DimensionViewport,
+	DimensionLanguage,
+	DimensionTimezone,
+	DimensionCountryCode,
+	DimensionRegion,
+	DimensionASN,
+}
+
+type CampaignItem struct {
+	Source            string  `json:"utm_source" db:"utm_source"`
+	Medium            string  `json:"utm_medium" db:"utm_medium"`
+	Campaign          string  `json:"utm_campaign" db:"utm_campaign"`
+	Visits            int     `json:"visits" db:"visits"`
+	UniqueUsers       int     `json:"unique_users" db:"unique_users"`
+	AvgDuration       float64 `json:"avg_duration" db:"avg_duration"`
+	AvgActiveDuration float64 `json:"avg_active_duration" db:"avg_active_duration"`
+}
+
+type BreakdownItem struct {
+	Value string `json:"value" db:"value"`
+	// Label names the value for display where it is an id, e.g.
+	// "AS16509 Amazon.com, Inc." for the asn 16509.
+	Label             string  `json:"label,omitempty" db:"label"`
+	Visits            int     `json:"visits" db:"visits"`
 	UniqueUsers       int     `json:"unique_users" db:"unique_users"`
 	AvgDuration       float64 `json:"avg_duration" db:"avg_duration"`
 	AvgActiveDuration float64 `json:"avg_active_duration" db:"avg_active_duration"`
-	AvgActions        float64 `json:"avg_actions" db:"avg_actions"`
+}
+
+type StatsBucket struct {
+	Time time.Time `json:"time" db:"bucket"`
+	Stats
+}
+
+// StatsChange holds the relative change of each metric against the previous
+// period, nil when the previous value is zero.
+type StatsChange struct {
+	TotalVisits          *float64 `json:"total_visits"`
+	UniqueUsers          *float64 `json:"unique_users"`
+	AvgDuration          *float64 `json:"avg_duration"`
+	AvgActiveDuration    *float64 `json:"avg_active_duration"`
+	MedianActiveDuration *float64 `json:"median_active_duration"`
+	P90ActiveDuration    *float64 `json:"p90_active_duration"`
+	AvgActions           *float64 `json:"avg_actions"`
+	PagesPerSession      *float64 `json:"pages_per_session"`
+	BounceRate           *float64 `json:"bounce_rate"`
+	ReturningRatio       *float64 `json:"returning_ratio"`
+}
+
+type StatsReport struct {
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Interval string        `json:"interval"`
+	Timezone string        `json:"timezone"`
+	Summary  Stats         `json:"summary"`
+	Previous Stats         `json:"previous"`
+	Change   StatsChange   `json:"change"`
+	Series   []StatsBucket `json:"series"`
+}
+
+// CohortCell is the number of users of a cohort seen in a given week after
+// their first visit, Week 0 being the first-visit week itself.
+type CohortCell struct {
+	Cohort time.Time `db:"cohort"`
+	Week   int       `db:"week"`
+	Users  int       `db:"users"`
+}
+
+type Cohort struct {
+	Week  time.Time `json:"week"`
+	Users int       `json:"users"`
+	// Retention holds the fraction of the cohort's users seen in each week
+	// since their first visit, index 0 being the first week itself. Weeks
+	// that have not started yet are nil.
+	Retention []*float64 `json:"retention"`
+}
+
+type CohortReport struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Timezone string    `json:"timezone"`
+	Weeks    int       `json:"weeks"`
+	Cohorts  []*Cohort `json:"cohorts"`
+}
+
+// VisitorProfile is everything known about one user_id.
+type VisitorProfile struct {
+	UserID    string             `json:"user_id"`
+	Visits    []*Data            `json:"visits"`
+	Locations []*ProfileLocation `json:"locations"`
+	Devices   []*ProfileDevice   `json:"devices"`
+	Actions   []*ActionCount     `json:"actions"`
+	Events    []*Event           `json:"events"`
+	Messages  []*Message         `json:"messages"`
+}
+
+type ProfileLocation struct {
+	Country string `json:"country"`
+	City    string `json:"city"`
+	Visits  int    `json:"visits"`
+}
+
+type ProfileDevice struct {
+	OS         string `json:"os"`
+	Browser    string `json:"browser"`
+	DeviceType string `json:"device_type"`
+	Visits     int    `json:"visits"`
+}
+
+type ActionCount struct {
+	Name  string `json:"name" db:"name"`
+	Count int    `json:"count" db:"count"`
+}
+
+// Live event types pushed to the admin dashboard.
+const (
+	LiveVisitStart = "visit-start"
+	LiveHeartbeat  = "heartbeat"
+	LiveVisitEnd   = "visit-end"
+)
+
+type LiveEvent struct {
+	Type           string    `json:"type"`
+	SessionID      string    `json:"session_id"`
+	UserID         string    `json:"user_id,omitempty"`
+	Country        string    `json:"country,omitempty"`
+	City           string    `json:"city,omitempty"`
+	OS             string    `json:"os,omitempty"`
+	Referrer       string    `json:"referrer,omitempty"`
+	Duration       float64   `json:"duration,omitempty"`
+	ActiveDuration float64   `json:"active_duration,omitempty"`
+	ActionsCount   int       `json:"actions_count,omitempty"`
+	Time           time.Time `json:"time"`
 }
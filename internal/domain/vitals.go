@@ -0,0 +1,64 @@
+package domain
+
+import "time"
+
+// Core Web Vitals and the other performance metrics we collect. CLS is
+// unitless, all others are in milliseconds.
+const (
+	VitalLCP  = "LCP"
+	VitalINP  = "INP"
+	VitalCLS  = "CLS"
+	VitalTTFB = "TTFB"
+	VitalFCP  = "FCP"
+)
+
+var WebVitals = []string{VitalLCP, VitalINP, VitalCLS, VitalTTFB, VitalFCP}
+
+// VitalsData is a set of metrics measured on one page view.
+type VitalsData struct {
+	SessionID string         `json:"session_id"`
+	URL       string         `json:"url"`
+	UserAgent string         `json:"user_agent"`
+	Metrics   []*VitalMetric `json:"metrics"`
+}
+
+type VitalMetric struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// VitalSample is a stored metric value.
+type VitalSample struct {
+	SessionID  string
+	Path       string
+	DeviceType string
+	Name       string
+	Value      float64
+	Time       time.Time
+}
+
+// VitalsFilter restricts the vitals report to a page and device class.
+type VitalsFilter struct {
+	AnalyticsFilter
+	Path       string
+	DeviceType string
+}
+
+type VitalsItem struct {
+	Time    *time.Time `json:"time,omitempty" db:"bucket"`
+	Path    string     `json:"path" db:"path"`
+	Name    string     `json:"name" db:"name"`
+	Samples int        `json:"samples" db:"samples"`
+	P50     float64    `json:"p50" db:"p50"`
+	P75     float64    `json:"p75" db:"p75"`
+	P95     float64    `json:"p95" db:"p95"`
+}
+
+type VitalsReport struct {
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Interval string        `json:"interval"`
+	Timezone string        `json:"timezone"`
+	Summary  []*VitalsItem `json:"summary"`
+	Series   []*VitalsItem `json:"series"`
+}
@@ -2,7 +2,12 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/ramisoul84/emil-server/internal/domain"
@@ -18,47 +23,476 @@ func NewAnalyticsRepository(db *sqlx.DB) *analyticsRepository {
 	return &analyticsRepository{db, logger.Get()}
 }
 
-func (r *analyticsRepository) SaveVisit(ctx context.Context, data *domain.Data) error {
+// landingPageExpr, exitPageExpr and pageviewsExpr derive the pages of a
+// visit (aliased v) from its pageviews, falling back to the landing URL.
+const (
+	landingPageExpr = `COALESCE(v.landing_page, (
+		SELECT p.path FROM pageviews p
+		WHERE p.session_id = v.session_id
+		ORDER BY p.time, p.id
+		LIMIT 1
+	))`
+	exitPageExpr = `COALESCE((
+		SELECT p.path FROM pageviews p
+		WHERE p.session_id = v.session_id
+		ORDER BY p.time DESC, p.id DESC
+		LIMIT 1
+	), v.landing_page)`
+	pageviewsExpr = `GREATEST((
+		SELECT COUNT(*) FROM pageviews p
+		WHERE p.session_id = v.session_id
+	), CASE WHEN v.landing_page IS NULL THEN 0 ELSE 1 END)`
+)
+
+// StartSession opens a session and writes the visit row right away, so a
+// visit is recorded even if visit-end never arrives.
+func (r *analyticsRepository) StartSession(ctx context.Context, data *domain.Data) error {
 	logger := r.logger.WithFields(
 		map[string]any{
 			"layer":      "analytics_repository",
-			"method":     "save_visit",
+			"method":     "start_session",
 			"request_id": ctx.Value("request_id").(string),
 		},
 	)
-	logger.Info().Msg("Store visit in DB")
+	logger.Info().Msg("Store session start in DB")
 
-	query := `
-            INSERT INTO visits (
-				session_id, user_id, ip, country, city, os,
-				start_time, duration, active_duration, actions_count
-				)
-            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		`
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A heartbeat that overtook the queued start may have opened the session
+	// already, with its own time as the start.
+	sessionQuery := `
+		INSERT INTO sessions (session_id, user_id, started_at, last_heartbeat_at, is_bot)
+		VALUES ($1, $2, $3, $3, $4)
+		ON CONFLICT (session_id) DO UPDATE SET
+			user_id = COALESCE(sessions.user_id, EXCLUDED.user_id),
+			started_at = LEAST(sessions.started_at, EXCLUDED.started_at),
+			is_bot = sessions.is_bot OR EXCLUDED.is_bot
+	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	if _, err := tx.ExecContext(ctx, sessionQuery, data.SessionID, data.UserID, data.StartTime, data.IsBot); err != nil {
+		logger.Error().Err(err).Msg("failed to save session")
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	visitQuery := `
+		INSERT INTO visits (
+			session_id, user_id, ip, country, city, os, browser, start_time,
+			landing_page, referrer, referrer_host, channel, source,
+			utm_source, utm_medium, utm_campaign, utm_term, utm_content,
+			is_bot, bot_reason,
+			browser_version, os_version, device_type, engine,
+			screen_width, screen_height, viewport_width, viewport_height, language, timezone,
+			country_code, region, latitude, longitude, geo_timezone, asn, isp
+			)
+		VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, NULLIF($20, ''),
+			$21, $22, $23, $24,
+			NULLIF($25, 0), NULLIF($26, 0), NULLIF($27, 0), NULLIF($28, 0), NULLIF($29, ''), NULLIF($30, ''),
+			NULLIF($31, ''), NULLIF($32, ''), $33, $34, NULLIF($35, ''), NULLIF($36, 0), NULLIF($37, '')
+			)
+		ON CONFLICT (session_id) DO NOTHING
+	`
+
+	_, err = tx.ExecContext(ctx, visitQuery,
 		data.SessionID,
 		data.UserID,
 		data.IP,
 		data.Country,
 		data.City,
 		data.OS,
+		data.Browser,
 		data.StartTime,
-		data.Duration,
+		data.LandingPage,
+		data.Referrer,
+		data.ReferrerHost,
+		data.Channel,
+		data.Source,
+		data.UTMSource,
+		data.UTMMedium,
+		data.UTMCampaign,
+		data.UTMTerm,
+		data.UTMContent,
+		data.IsBot,
+		data.BotReason,
+		data.BrowserVersion,
+		data.OSVersion,
+		data.DeviceType,
+		data.Engine,
+		data.ScreenWidth,
+		data.ScreenHeight,
+		data.ViewportWidth,
+		data.ViewportHeight,
+		data.Language,
+		data.Timezone,
+		data.CountryCode,
+		data.Region,
+		data.Latitude,
+		data.Longitude,
+		data.GeoTimezone,
+		data.ASN,
+		data.ISP,
+	)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to save visit")
+		return fmt.Errorf("failed to save visit: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error().Err(err).Msg("failed to commit session start")
+		return fmt.Errorf("failed to commit session start: %w", err)
+	}
+
+	logger.Info().Msg("session started successfully")
+
+	return nil
+}
+
+// TouchSession records a heartbeat for an open session. Visit-start is
+// processed asynchronously, so a heartbeat can come first and opens the
+// session itself. Only a session that was already closed is not found. It
+// reports whether the session is flagged as a bot.
+func (r *analyticsRepository) TouchSession(ctx context.Context, sessionID string, activeDuration float64, actions map[string]int, firstSeen map[string]time.Time, actionsCount int, at time.Time) (bool, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "touch_session",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Debug().Msg("Update session heartbeat")
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to begin transaction")
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO sessions (session_id, started_at, last_heartbeat_at, active_duration, actions_count)
+		VALUES ($1, $2, $2, $3, $4)
+		ON CONFLICT (session_id) DO UPDATE SET
+			last_heartbeat_at = GREATEST(sessions.last_heartbeat_at, EXCLUDED.last_heartbeat_at),
+			active_duration = GREATEST(sessions.active_duration, EXCLUDED.active_duration),
+			actions_count = GREATEST(sessions.actions_count, EXCLUDED.actions_count)
+		WHERE sessions.ended_at IS NULL
+		RETURNING is_bot
+	`
+
+	var isBot bool
+	err = tx.GetContext(ctx, &isBot, query, sessionID, at, activeDuration, actionsCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Info().Msg("session already closed")
+			return false, domain.ErrNotFound
+		}
+		logger.Error().Err(err).Msg("failed to update session")
+		return false, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if err := saveActions(ctx, tx, sessionID, actions, firstSeen, at); err != nil {
+		logger.Error().Err(err).Msg("failed to save actions")
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error().Err(err).Msg("failed to commit heartbeat")
+		return false, fmt.Errorf("failed to commit heartbeat: %w", err)
+	}
+
+	return isBot, nil
+}
+
+// saveActions stores the action counts of a session. Clients send running
+// totals, so a count never goes down. An action is dated by firstSeen, or
+// else by at, the time it was reported, and keeps its earliest date.
+func saveActions(ctx context.Context, tx *sqlx.Tx, sessionID string, actions map[string]int, firstSeen map[string]time.Time, at time.Time) error {
+	query := `
+		INSERT INTO visit_actions (session_id, name, count, first_seen)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (session_id, name) DO UPDATE SET
+			count = GREATEST(visit_actions.count, EXCLUDED.count),
+			first_seen = LEAST(visit_actions.first_seen, EXCLUDED.first_seen)
+	`
+
+	for name, count := range actions {
+		seen, ok := firstSeen[name]
+		if !ok {
+			seen = at
+		}
+		if _, err := tx.ExecContext(ctx, query, sessionID, name, count, seen); err != nil {
+			return fmt.Errorf("failed to save action %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// EndSession closes the session at endTime and stores the final visit.
+// The duration is measured from the stored session start when there is one.
+func (r *analyticsRepository) EndSession(ctx context.Context, data *domain.Data, endTime time.Time) error {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "end_session",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Msg("Store session end in DB")
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	sessionQuery := `
+		INSERT INTO sessions (
+			session_id, user_id, started_at, last_heartbeat_at,
+			ended_at, active_duration, actions_count, is_bot
+			)
+		VALUES ($1, $2, $3, $4, $4, $5, $6, $7)
+		ON CONFLICT (session_id) DO UPDATE SET
+			last_heartbeat_at = EXCLUDED.last_heartbeat_at,
+			ended_at = EXCLUDED.ended_at,
+			active_duration = EXCLUDED.active_duration,
+			actions_count = EXCLUDED.actions_count,
+			is_bot = sessions.is_bot OR EXCLUDED.is_bot
+		RETURNING EXTRACT(EPOCH FROM ended_at - started_at)
+	`
+
+	startTime := endTime.Add(-time.Duration(data.Duration * float64(time.Second)))
+	err = tx.GetContext(ctx, &data.Duration, sessionQuery,
+		data.SessionID,
+		data.UserID,
+		startTime,
+		endTime,
 		data.ActiveDuration,
 		data.ActionsCount,
+		data.IsBot,
 	)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to close session")
+		return fmt.Errorf("failed to close session: %w", err)
+	}
+
+	visitQuery := `
+		INSERT INTO visits (
+			session_id, user_id, ip, country, city, os, browser, start_time,
+			duration, active_duration, actions_count,
+			referrer, referrer_host, channel, source,
+			utm_source, utm_medium, utm_campaign, utm_term, utm_content,
+			is_bot, bot_reason,
+			browser_version, os_version, device_type, engine,
+			screen_width, screen_height, viewport_width, viewport_height, language, timezone,
+			country_code, region, latitude, longitude, geo_timezone, asn, isp
+			)
+		VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, NULLIF($22, ''),
+			$23, $24, $25, $26,
+			NULLIF($27, 0), NULLIF($28, 0), NULLIF($29, 0), NULLIF($30, 0), NULLIF($31, ''), NULLIF($32, ''),
+			NULLIF($33, ''), NULLIF($34, ''), $35, $36, NULLIF($37, ''), NULLIF($38, 0), NULLIF($39, '')
+			)
+		ON CONFLICT (session_id) DO UPDATE SET
+			duration = EXCLUDED.duration,
+			active_duration = EXCLUDED.active_duration,
+			actions_count = EXCLUDED.actions_count,
+			is_bot = visits.is_bot OR EXCLUDED.is_bot,
+			bot_reason = COALESCE(visits.bot_reason, EXCLUDED.bot_reason)
+	`
 
+	_, err = tx.ExecContext(ctx, visitQuery,
+		data.SessionID,
+		data.UserID,
+		data.IP,
+		data.Country,
+		data.City,
+		data.OS,
+		data.Browser,
+		startTime,
+		data.Duration,
+		data.ActiveDuration,
+		data.ActionsCount,
+		data.Referrer,
+		data.ReferrerHost,
+		data.Channel,
+		data.Source,
+		data.UTMSource,
+		data.UTMMedium,
+		data.UTMCampaign,
+		data.UTMTerm,
+		data.UTMContent,
+		data.IsBot,
+		data.BotReason,
+		data.BrowserVersion,
+		data.OSVersion,
+		data.DeviceType,
+		data.Engine,
+		data.ScreenWidth,
+		data.ScreenHeight,
+		data.ViewportWidth,
+		data.ViewportHeight,
+		data.Language,
+		data.Timezone,
+		data.CountryCode,
+		data.Region,
+		data.Latitude,
+		data.Longitude,
+		data.GeoTimezone,
+		data.ASN,
+		data.ISP,
+	)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to save visit")
 		return fmt.Errorf("failed to save visit: %w", err)
 	}
 
+	pagesQuery := `
+		UPDATE visits v
+		SET landing_page = ` + landingPageExpr + `,
+			exit_page = ` + exitPageExpr + `,
+			pageviews = ` + pageviewsExpr + `
+		WHERE v.session_id = $1
+	`
+
+	if _, err := tx.ExecContext(ctx, pagesQuery, data.SessionID); err != nil {
+		logger.Error().Err(err).Msg("failed to update visit pages")
+		return fmt.Errorf("failed to update visit pages: %w", err)
+	}
+
+	if err := saveActions(ctx, tx, data.SessionID, data.Actions, data.ActionsFirstSeen, endTime); err != nil {
+		logger.Error().Err(err).Msg("failed to save actions")
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error().Err(err).Msg("failed to commit session end")
+		return fmt.Errorf("failed to commit session end: %w", err)
+	}
+
 	logger.Info().Msg("visit saved successfully")
 
 	return nil
 }
 
+// FinalizeStaleSessions closes open sessions whose last heartbeat is older
+// than cutoff, using the last heartbeat as their end time, and writes the
+// resulting durations to their visits.
+func (r *analyticsRepository) FinalizeStaleSessions(ctx context.Context, cutoff time.Time) (int64, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "finalize_stale_sessions",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Debug().Msg("Finalize stale sessions")
+
+	query := `
+		WITH closed AS (
+			UPDATE sessions
+			SET ended_at = last_heartbeat_at
+			WHERE ended_at IS NULL AND last_heartbeat_at < $1
+			RETURNING session_id, started_at, ended_at, active_duration, actions_count
+		)
+		UPDATE visits v
+		SET duration = EXTRACT(EPOCH FROM c.ended_at - c.started_at),
+			active_duration = c.active_duration,
+			actions_count = c.actions_count,
+			landing_page = ` + landingPageExpr + `,
+			exit_page = ` + exitPageExpr + `,
+			pageviews = ` + pageviewsExpr + `
+		FROM closed c
+		WHERE v.session_id = c.session_id
+	`
+
+	result, err := r.db.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to finalize sessions")
+		return 0, fmt.Errorf("failed to finalize sessions: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// CountActiveSessions counts open sessions with a heartbeat since the given time.
+func (r *analyticsRepository) CountActiveSessions(ctx context.Context, since time.Time) (int, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "count_active_sessions",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	query := `
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE ended_at IS NULL AND last_heartbeat_at >= $1 AND NOT is_bot
+	`
+
+	var count int
+	if err := r.db.GetContext(ctx, &count, query, since); err != nil {
+		logger.Error().Err(err).Msg("failed to count active sessions")
+		return 0, fmt.Errorf("failed to count active sessions: %w", err)
+	}
+
+	return count, nil
+}
+
+// visitColumns selects a visit as domain.Data. The duration columns stay
+// NULL until the session is finalized.
+const visitColumns = `
+	id, session_id, user_id,
+	COALESCE(ip, '') AS ip,
+	country, city, os,
+	COALESCE(browser, '') AS browser,
+	start_time,
+	COALESCE(duration, 0) AS duration,
+	COALESCE(active_duration, 0) AS active_duration,
+	COALESCE(actions_count, 0) AS actions_count,
+	COALESCE(landing_page, '') AS landing_page,
+	COALESCE(exit_page, '') AS exit_page,
+	COALESCE(referrer, '') AS referrer,
+	COALESCE(referrer_host, '') AS referrer_host,
+	COALESCE(channel, '') AS channel,
+	COALESCE(source, '') AS source,
+	COALESCE(utm_source, '') AS utm_source,
+	COALESCE(utm_medium, '') AS utm_medium,
+	COALESCE(utm_campaign, '') AS utm_campaign,
+	COALESCE(utm_term, '') AS utm_term,
+	COALESCE(utm_content, '') AS utm_content,
+	is_bot,
+	COALESCE(bot_reason, '') AS bot_reason,
+	COALESCE(browser_version, '') AS browser_version,
+	COALESCE(os_version, '') AS os_version,
+	COALESCE(device_type, '') AS device_type,
+	COALESCE(engine, '') AS engine,
+	COALESCE(screen_width, 0) AS screen_width,
+	COALESCE(screen_height, 0) AS screen_height,
+	COALESCE(viewport_width, 0) AS viewport_width,
+	COALESCE(viewport_height, 0) AS viewport_height,
+	COALESCE(language, '') AS language,
+	COALESCE(timezone, '') AS timezone,
+	COALESCE(country_code, '') AS country_code,
+	COALESCE(region, '') AS region,
+	latitude, longitude,
+	COALESCE(geo_timezone, '') AS geo_timezone,
+	COALESCE(asn, 0) AS asn,
+	COALESCE(isp, '') AS isp
+`
+
 func (r *analyticsRepository) ListVisits(ctx context.Context, limit, offset int) ([]*domain.Data, error) {
 	logger := r.logger.WithFields(
 		map[string]any{
@@ -81,7 +515,7 @@ func (r *analyticsRepository) ListVisits(ctx context.Context, limit, offset int)
 	}
 
 	query := `
-		SELECT *
+		SELECT ` + visitColumns + `
 		FROM visits 
 		ORDER BY start_time DESC 
 		LIMIT $1 OFFSET $2
@@ -99,7 +533,112 @@ func (r *analyticsRepository) ListVisits(ctx context.Context, limit, offset int)
 	return data, nil
 }
 
-func (r *analyticsRepository) GetVisitsStats(ctx context.Context) (*domain.Stats, error) {
+// statsColumns aggregates visits (aliased v) into domain.Stats. Engagement
+// metrics only consider finished visits, which have a duration. The bounce
+// threshold in seconds is read from the given placeholder.
+func statsColumns(bounceThreshold string) string {
+	return `
+	COUNT(v.id) AS total_visits,
+	COUNT(DISTINCT v.user_id) AS unique_users,
+	COALESCE(AVG(v.duration), 0) AS avg_duration,
+	COALESCE(AVG(v.active_duration), 0) AS avg_active_duration,
+	COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY v.active_duration), 0) AS median_active_duration,
+	COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY v.active_duration), 0) AS p90_active_duration,
+	COALESCE(AVG(v.actions_count), 0) AS avg_actions,
+	COALESCE(AVG(v.pageviews), 0) AS pages_per_session,
+	COALESCE(AVG(
+		CASE WHEN COALESCE(v.pageviews, 0) <= 1
+			AND (COALESCE(v.actions_count, 0) = 0 OR COALESCE(v.active_duration, 0) < ` + bounceThreshold + `)
+		THEN 1.0 ELSE 0.0 END
+	) FILTER (WHERE v.duration IS NOT NULL), 0) AS bounce_rate,
+	COALESCE(AVG(
+		CASE WHEN EXISTS (
+			SELECT 1 FROM visits prev
+			WHERE prev.user_id = v.user_id AND prev.start_time < v.start_time AND NOT prev.is_bot
+		) THEN 1.0 ELSE 0.0 END
+	) FILTER (WHERE v.user_id <> ''), 0) AS returning_ratio
+`
+}
+
+// visitsInRange restricts visits (aliased v) to [$1, $2). start_time holds UTC.
+const visitsInRange = `
+	v.start_time >= ($1::timestamptz AT TIME ZONE 'UTC')
+	AND v.start_time < ($2::timestamptz AT TIME ZONE 'UTC')
+`
+
+// dimensionColumns maps breakdown dimensions to visits (aliased v) columns
+// or expressions over them.
+var dimensionColumns = map[string]string{
+	domain.DimensionCountry:        "v.country",
+	domain.DimensionCity:           "v.city",
+	domain.DimensionOS:             "v.os",
+	domain.DimensionBrowser:        "v.browser",
+	domain.DimensionReferrer:       "v.referrer_host",
+	domain.DimensionChannel:        "v.channel",
+	domain.DimensionSource:         "v.source",
+	domain.DimensionUTMSource:      "v.utm_source",
+	domain.DimensionMedium:         "v.utm_medium",
+	domain.DimensionCampaign:       "v.utm_campaign",
+	domain.DimensionLanding:        "v.landing_page",
+	domain.DimensionExit:           "v.exit_page",
+	domain.DimensionBotReason:      "v.bot_reason",
+	domain.DimensionDeviceType:     "v.device_type",
+	domain.DimensionBrowserVersion: "concat_ws(' ', v.browser, NULLIF(split_part(v.browser_version, '.', 1), ''))",
+	domain.DimensionOSVersion:      "concat_ws(' ', v.os, NULLIF(v.os_version, ''))",
+	domain.DimensionEngine:         "v.engine",
+	domain.DimensionScreen:         "v.screen_width || 'x' || v.screen_height",
+	domain.DimensionViewport:       "v.viewport_width || 'x' || v.viewport_height",
+	domain.DimensionLanguage:       "v.language",
+	domain.DimensionTimezone:       "v.timezone",
+	domain.DimensionCountryCode:    "v.country_code",
+	domain.DimensionRegion:         "v.region",
+	domain.DimensionASN:            "v.asn::text",
+}
+
+// dimensionLabels are aggregates naming a breakdown value for display, for
+// dimensions whose value is an id. Other dimensions have no label.
+var dimensionLabels = map[string]string{
+	// Providers name the same network differently, the most common name wins.
+	domain.DimensionASN: "concat_ws(' ', 'AS' || MIN(v.asn), mode() WITHIN GROUP (ORDER BY NULLIF(v.isp, '')))",
+}
+
+// visitsWhere builds the WHERE clause for the filter range and drill-down
+// filters. The range always takes $1 and $2. Bots are left out unless the
+// filter includes them.
+func visitsWhere(filter *domain.AnalyticsFilter) (string, []any, error) {
+	clause := visitsInRange
+	args := []any{filter.From, filter.To}
+
+	if !filter.IncludeBots {
+		clause += " AND NOT v.is_bot"
+	}
+
+	filters, args, err := dimensionFilters(filter, args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return clause + filters, args, nil
+}
+
+// dimensionFilters returns the drill-down filters of filter as conditions on
+// visits (aliased v), each starting with AND, with their values appended to
+// args.
+func dimensionFilters(filter *domain.AnalyticsFilter, args []any) (string, []any, error) {
+	var clause string
+	for dimension, value := range filter.Filters {
+		column, ok := dimensionColumns[dimension]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown dimension %q", dimension)
+		}
+		args = append(args, value)
+		clause += fmt.Sprintf(" AND COALESCE(%s, '') = $%d", column, len(args))
+	}
+
+	return clause, args, nil
+}
+
+func (r *analyticsRepository) GetVisitsStats(ctx context.Context, filter *domain.AnalyticsFilter) (*domain.Stats, error) {
 	logger := r.logger.WithFields(
 		map[string]any{
 			"layer":      "analytics_repository",
@@ -110,22 +649,1112 @@ func (r *analyticsRepository) GetVisitsStats(ctx context.Context) (*domain.Stats
 
 	logger.Info().Msg("Get visits stats")
 
+	where, args, err := visitsWhere(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, filter.BounceThreshold)
 	query := `
-		SELECT 
-			COUNT(*) as total_visits,
-			COUNT(DISTINCT user_id) as unique_users,
-			COALESCE(AVG(duration), 0) as avg_duration,
-			COALESCE(AVG(active_duration), 0) as avg_active_duration,
-			COALESCE(AVG(actions_count), 0) as avg_actions
-		FROM visits;
-	`
+		SELECT ` + statsColumns(fmt.Sprintf("$%d", len(args))) + `
+		FROM visits v
+		WHERE ` + where
 
 	var stats domain.Stats
-	err := r.db.GetContext(ctx, &stats, query)
+	err = r.db.GetContext(ctx, &stats, query, args...)
 	if err != nil {
-		r.logger.Error().Err(err).Msg("Failed to get visit stats")
+		logger.Error().Err(err).Msg("Failed to get visit stats")
 		return nil, fmt.Errorf("failed to get stats: %w", err)
 	}
 
 	return &stats, nil
 }
+
+// GetStatsSeries returns one stats bucket per interval of the filter range,
+// truncated in the filter timezone. Buckets without visits are included.
+func (r *analyticsRepository) GetStatsSeries(ctx context.Context, filter *domain.AnalyticsFilter) ([]domain.StatsBucket, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "stats_series",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get visits stats series")
+
+	where, args, err := visitsWhere(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, filter.Interval, filter.Timezone, filter.BounceThreshold)
+	interval := fmt.Sprintf("$%d", len(args)-2)
+	timezone := fmt.Sprintf("$%d", len(args)-1)
+	bounceThreshold := fmt.Sprintf("$%d", len(args))
+
+	query := `
+		WITH buckets AS (
+			SELECT generate_series(
+				date_trunc(` + interval + `, $1::timestamptz AT TIME ZONE ` + timezone + `),
+				date_trunc(` + interval + `, ($2::timestamptz - INTERVAL '1 microsecond') AT TIME ZONE ` + timezone + `),
+				('1 ' || ` + interval + `)::interval
+			) AS bucket
+		),
+		v AS (
+			SELECT date_trunc(` + interval + `, v.start_time AT TIME ZONE 'UTC' AT TIME ZONE ` + timezone + `) AS bucket, v.*
+			FROM visits v
+			WHERE ` + where + `
+		)
+		SELECT b.bucket AT TIME ZONE ` + timezone + ` AS bucket, ` + statsColumns(bounceThreshold) + `
+		FROM buckets b
+		LEFT JOIN v ON v.bucket = b.bucket
+		GROUP BY b.bucket
+		ORDER BY b.bucket
+	`
+
+	var series []domain.StatsBucket
+	err = r.db.SelectContext(ctx, &series, query, args...)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get stats series")
+		return nil, fmt.Errorf("failed to get stats series: %w", err)
+	}
+
+	return series, nil
+}
+
+// GetBreakdown groups visits by a dimension and returns the top values.
+func (r *analyticsRepository) GetBreakdown(ctx context.Context, filter *domain.AnalyticsFilter, dimension string, limit int) ([]*domain.BreakdownItem, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "breakdown",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Str("dimension", dimension).Msg("Get visits breakdown")
+
+	column, ok := dimensionColumns[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown dimension %q", dimension)
+	}
+
+	label, ok := dimensionLabels[dimension]
+	if !ok {
+		label = "''"
+	}
+
+	where, args, err := visitsWhere(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, limit)
+	query := fmt.Sprintf(`
+		SELECT
+			COALESCE(%s, '') AS value,
+			COALESCE(%s, '') AS label,
+			COUNT(v.id) AS visits,
+			COUNT(DISTINCT v.user_id) AS unique_users,
+			COALESCE(AVG(v.duration), 0) AS avg_duration,
+			COALESCE(AVG(v.active_duration), 0) AS avg_active_duration
+		FROM visits v
+		WHERE %s
+		GROUP BY 1
+		ORDER BY visits DESC, value
+		LIMIT $%d
+	`, column, label, where, len(args))
+
+	var items []*domain.BreakdownItem
+	if err := r.db.SelectContext(ctx, &items, query, args...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get breakdown")
+		return nil, fmt.Errorf("failed to get breakdown: %w", err)
+	}
+
+	return items, nil
+}
+
+// GetCampaigns groups visits that carry utm parameters by source, medium and campaign.
+func (r *analyticsRepository) GetCampaigns(ctx context.Context, filter *domain.AnalyticsFilter) ([]*domain.CampaignItem, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "campaigns",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get campaigns report")
+
+	where, args, err := visitsWhere(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT
+			COALESCE(v.utm_source, '') AS utm_source,
+			COALESCE(v.utm_medium, '') AS utm_medium,
+			COALESCE(v.utm_campaign, '') AS utm_campaign,
+			COUNT(v.id) AS visits,
+			COUNT(DISTINCT v.user_id) AS unique_users,
+			COALESCE(AVG(v.duration), 0) AS avg_duration,
+			COALESCE(AVG(v.active_duration), 0) AS avg_active_duration
+		FROM visits v
+		WHERE ` + where + `
+			AND (v.utm_source <> '' OR v.utm_medium <> '' OR v.utm_campaign <> '')
+		GROUP BY 1, 2, 3
+		ORDER BY visits DESC
+	`
+
+	var campaigns []*domain.CampaignItem
+	if err := r.db.SelectContext(ctx, &campaigns, query, args...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get campaigns")
+		return nil, fmt.Errorf("failed to get campaigns: %w", err)
+	}
+
+	return campaigns, nil
+}
+
+// GetTopPages reports pageviews per path in the filter range. Time on page is
+// the gap to the next pageview of the same session, so exits don't count
+// towards it.
+func (r *analyticsRepository) GetTopPages(ctx context.Context, filter *domain.AnalyticsFilter, limit int) ([]*domain.PageItem, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "top_pages",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get top pages")
+
+	filters, args, err := dimensionFilters(filter, []any{filter.From, filter.To, limit, filter.IncludeBots})
+	if err != nil {
+		return nil, err
+	}
+
+	// The next pageview may fall after the range, so only the end of the
+	// range is applied after LEAD. Pageviews before the range never follow
+	// one in it.
+	query := `
+		WITH pv AS (
+			SELECT p.path, p.session_id, p.time,
+				LEAD(p.time) OVER (PARTITION BY p.session_id ORDER BY p.time, p.id) AS next_time
+			FROM pageviews p
+			WHERE p.time >= ($1::timestamptz AT TIME ZONE 'UTC')
+		)
+		SELECT
+			pv.path,
+			COUNT(*) AS views,
+			COUNT(DISTINCT COALESCE(NULLIF(v.user_id, ''), pv.session_id)) AS unique_visitors,
+			COALESCE(AVG(EXTRACT(EPOCH FROM pv.next_time - pv.time)), 0) AS avg_time_on_page,
+			COUNT(*) FILTER (WHERE pv.next_time IS NULL) AS exits,
+			COUNT(*) FILTER (WHERE pv.next_time IS NULL)::float / COUNT(*) AS exit_rate
+		FROM pv
+		LEFT JOIN visits v ON v.session_id = pv.session_id
+		WHERE pv.time < ($2::timestamptz AT TIME ZONE 'UTC')
+			AND ($4 OR NOT COALESCE(v.is_bot, FALSE))` + filters + `
+		GROUP BY pv.path
+		ORDER BY views DESC, pv.path
+		LIMIT $3
+	`
+
+	var pages []*domain.PageItem
+	if err := r.db.SelectContext(ctx, &pages, query, args...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get top pages")
+		return nil, fmt.Errorf("failed to get top pages: %w", err)
+	}
+
+	return pages, nil
+}
+
+// GetCohorts groups users by the week of their first visit, in the filter
+// timezone, and counts how many of each cohort were seen in each of the
+// following weeks. Only cohorts starting in the filter range are returned.
+func (r *analyticsRepository) GetCohorts(ctx context.Context, filter *domain.AnalyticsFilter, weeks int) ([]domain.CohortCell, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "cohorts",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get retention cohorts")
+
+	query := `
+		WITH user_weeks AS (
+			SELECT DISTINCT v.user_id,
+				date_trunc('week', v.start_time AT TIME ZONE 'UTC' AT TIME ZONE $3) AS week
+			FROM visits v
+			WHERE COALESCE(v.user_id, '') <> '' AND ($5 OR NOT v.is_bot)
+		),
+		cohorts AS (
+			SELECT user_id, MIN(week) AS cohort
+			FROM user_weeks
+			GROUP BY user_id
+		)
+		SELECT
+			c.cohort AT TIME ZONE $3 AS cohort,
+			EXTRACT(DAY FROM uw.week - c.cohort)::int / 7 AS week,
+			COUNT(*) AS users
+		FROM cohorts c
+		JOIN user_weeks uw ON uw.user_id = c.user_id
+		WHERE c.cohort >= date_trunc('week', $1::timestamptz AT TIME ZONE $3)
+			AND c.cohort < ($2::timestamptz AT TIME ZONE $3)
+			AND uw.week <= c.cohort + $4 * INTERVAL '1 week'
+		GROUP BY c.cohort, week
+		ORDER BY c.cohort, week
+	`
+
+	var cells []domain.CohortCell
+	if err := r.db.SelectContext(ctx, &cells, query, filter.From, filter.To, filter.Timezone, weeks, filter.IncludeBots); err != nil {
+		logger.Error().Err(err).Msg("Failed to get cohorts")
+		return nil, fmt.Errorf("failed to get cohorts: %w", err)
+	}
+
+	return cells, nil
+}
+
+// maxUserVisits caps the visits returned for a single user.
+const maxUserVisits = 1000
+
+// ListUserVisits returns the visits of a user, oldest first.
+func (r *analyticsRepository) ListUserVisits(ctx context.Context, userID string) ([]*domain.Data, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "list_user_visits",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get visits of user")
+
+	query := `
+		SELECT ` + visitColumns + `
+		FROM visits
+		WHERE user_id = $1
+		ORDER BY start_time
+		LIMIT $2
+	`
+
+	var data []*domain.Data
+	if err := r.db.SelectContext(ctx, &data, query, userID, maxUserVisits); err != nil {
+		logger.Error().Err(err).Msg("Failed to list user visits")
+		return nil, fmt.Errorf("failed to list user visits: %w", err)
+	}
+
+	return data, nil
+}
+
+// GetUserActions sums the actions of all sessions of a user by name.
+func (r *analyticsRepository) GetUserActions(ctx context.Context, userID string) ([]*domain.ActionCount, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "user_actions",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get actions of user")
+
+	query := `
+		SELECT a.name, SUM(a.count) AS count
+		FROM visit_actions a
+		JOIN visits v ON v.session_id = a.session_id
+		WHERE v.user_id = $1
+		GROUP BY a.name
+		ORDER BY count DESC, a.name
+	`
+
+	actions := []*domain.ActionCount{}
+	if err := r.db.SelectContext(ctx, &actions, query, userID); err != nil {
+		logger.Error().Err(err).Msg("Failed to get user actions")
+		return nil, fmt.Errorf("failed to get user actions: %w", err)
+	}
+
+	return actions, nil
+}
+
+// SaveVitals stores performance metric samples in a single statement.
+func (r *analyticsRepository) SaveVitals(ctx context.Context, samples []*domain.VitalSample) error {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "save_vitals",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Int("count", len(samples)).Msg("Store web vitals in DB")
+
+	values := make([]string, 0, len(samples))
+	args := make([]any, 0, len(samples)*6)
+	for _, sample := range samples {
+		n := len(args)
+		values = append(values, fmt.Sprintf("(NULLIF($%d, ''), $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6))
+		args = append(args, sample.SessionID, sample.Path, sample.DeviceType, sample.Name, sample.Value, sample.Time)
+	}
+
+	query := `
+		INSERT INTO web_vitals (session_id, path, device_type, name, value, time)
+		VALUES ` + strings.Join(values, ", ")
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		logger.Error().Err(err).Msg("failed to save web vitals")
+		return fmt.Errorf("failed to save web vitals: %w", err)
+	}
+
+	return nil
+}
+
+// vitalsPercentiles aggregates web_vitals rows (aliased w).
+const vitalsPercentiles = `
+	COUNT(*) AS samples,
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY w.value) AS p50,
+	percentile_cont(0.75) WITHIN GROUP (ORDER BY w.value) AS p75,
+	percentile_cont(0.95) WITHIN GROUP (ORDER BY w.value) AS p95
+`
+
+// GetVitals returns p50, p75 and p95 per page and metric over the whole
+// range, and per interval bucket in the filter timezone.
+func (r *analyticsRepository) GetVitals(ctx context.Context, filter *domain.VitalsFilter) ([]*domain.VitalsItem, []*domain.VitalsItem, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "vitals",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get web vitals")
+
+	where := `
+		w.time >= ($1::timestamptz AT TIME ZONE 'UTC')
+		AND w.time < ($2::timestamptz AT TIME ZONE 'UTC')
+		AND ($3 = '' OR w.path = $3)
+		AND ($4 = '' OR w.device_type = $4)
+	`
+	args := []any{filter.From, filter.To, filter.Path, filter.DeviceType}
+
+	summaryQuery := `
+		SELECT w.path, w.name, ` + vitalsPercentiles + `
+		FROM web_vitals w
+		WHERE ` + where + `
+		GROUP BY w.path, w.name
+		ORDER BY samples DESC, w.path, w.name
+	`
+
+	summary := []*domain.VitalsItem{}
+	if err := r.db.SelectContext(ctx, &summary, summaryQuery, args...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get web vitals summary")
+		return nil, nil, fmt.Errorf("failed to get web vitals summary: %w", err)
+	}
+
+	seriesQuery := `
+		SELECT
+			date_trunc($5, w.time AT TIME ZONE 'UTC' AT TIME ZONE $6) AT TIME ZONE $6 AS bucket,
+			w.path, w.name, ` + vitalsPercentiles + `
+		FROM web_vitals w
+		WHERE ` + where + `
+		GROUP BY 1, w.path, w.name
+		ORDER BY 1, w.path, w.name
+	`
+
+	series := []*domain.VitalsItem{}
+	if err := r.db.SelectContext(ctx, &series, seriesQuery, append(args, filter.Interval, filter.Timezone)...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get web vitals series")
+		return nil, nil, fmt.Errorf("failed to get web vitals series: %w", err)
+	}
+
+	return summary, series, nil
+}
+
+// SaveInteractions stores the clicks and scroll depth of a page view together.
+func (r *analyticsRepository) SaveInteractions(ctx context.Context, clicks []*domain.ClickSample, scroll *domain.ScrollSample) error {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "save_interactions",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Int("clicks", len(clicks)).Msg("Store page interactions in DB")
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if len(clicks) > 0 {
+		values := make([]string, 0, len(clicks))
+		args := make([]any, 0, len(clicks)*7)
+		for _, click := range clicks {
+			n := len(args)
+			values = append(values, fmt.Sprintf("(NULLIF($%d, ''), $%d, $%d, $%d, NULLIF($%d, ''), $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+			args = append(args, click.SessionID, click.Path, click.X, click.Y, click.Selector, click.DeviceType, click.Time)
+		}
+
+		query := `
+			INSERT INTO clicks (session_id, path, x, y, selector, device_type, time)
+			VALUES ` + strings.Join(values, ", ")
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			logger.Error().Err(err).Msg("failed to save clicks")
+			return fmt.Errorf("failed to save clicks: %w", err)
+		}
+	}
+
+	if scroll != nil {
+		query := `
+			INSERT INTO scroll_depths (session_id, path, depth, device_type, time)
+			VALUES (NULLIF($1, ''), $2, $3, $4, $5)
+		`
+
+		if _, err := tx.ExecContext(ctx, query, scroll.SessionID, scroll.Path, scroll.Depth, scroll.DeviceType, scroll.Time); err != nil {
+			logger.Error().Err(err).Msg("failed to save scroll depth")
+			return fmt.Errorf("failed to save scroll depth: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error().Err(err).Msg("failed to commit interactions")
+		return fmt.Errorf("failed to commit interactions: %w", err)
+	}
+
+	return nil
+}
+
+// heatmapWhere restricts clicks or scroll_depths rows (aliased h) to the
+// range, page and device class of a heatmap filter, using $1 to $4.
+const heatmapWhere = `
+	h.time >= ($1::timestamptz AT TIME ZONE 'UTC')
+	AND h.time < ($2::timestamptz AT TIME ZONE 'UTC')
+	AND ($3 = '' OR h.path = $3)
+	AND ($4 = '' OR h.device_type = $4)
+`
+
+// heatmapPages picks the pages with the most interactions, using $5 as limit.
+const heatmapPages = `
+	WITH pages AS (
+		SELECT path, COUNT(*) FILTER (WHERE is_click) AS clicks
+		FROM (
+			SELECT h.path, TRUE AS is_click FROM clicks h WHERE ` + heatmapWhere + `
+			UNION ALL
+			SELECT h.path, FALSE AS is_click FROM scroll_depths h WHERE ` + heatmapWhere + `
+		) interactions
+		GROUP BY path
+		ORDER BY COUNT(*) DESC, path
+		LIMIT $5
+	)
+`
+
+// GetHeatmap returns, for the pages with the most interactions, click counts
+// on a grid of filter.Grid cells per axis, the most clicked selectors and
+// the scroll depth distribution.
+func (r *analyticsRepository) GetHeatmap(ctx context.Context, filter *domain.HeatmapFilter, selectors int) ([]*domain.HeatmapPage, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "heatmap",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get heatmap")
+
+	args := []any{filter.From, filter.To, filter.Path, filter.DeviceType, filter.Limit}
+
+	var pageRows []struct {
+		Path   string `db:"path"`
+		Clicks int    `db:"clicks"`
+	}
+	pagesQuery := heatmapPages + `SELECT path, clicks FROM pages ORDER BY clicks DESC, path`
+	if err := r.db.SelectContext(ctx, &pageRows, pagesQuery, args...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get heatmap pages")
+		return nil, fmt.Errorf("failed to get heatmap pages: %w", err)
+	}
+
+	pages := make([]*domain.HeatmapPage, 0, len(pageRows))
+	byPath := make(map[string]*domain.HeatmapPage, len(pageRows))
+	for _, row := range pageRows {
+		page := &domain.HeatmapPage{
+			Path:      row.Path,
+			Clicks:    row.Clicks,
+			Cells:     []*domain.HeatmapCell{},
+			Selectors: []*domain.SelectorCount{},
+		}
+		pages = append(pages, page)
+		byPath[row.Path] = page
+	}
+	if len(pages) == 0 {
+		return pages, nil
+	}
+
+	cellsQuery := heatmapPages + `
+		SELECT
+			h.path,
+			LEAST(FLOOR(h.x * $6::int), $6::int - 1)::int AS x,
+			LEAST(FLOOR(h.y * $6::int), $6::int - 1)::int AS y,
+			COUNT(*) AS clicks
+		FROM clicks h
+		WHERE ` + heatmapWhere + ` AND h.path IN (SELECT path FROM pages)
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 3, 2
+	`
+
+	var cells []*domain.HeatmapCell
+	if err := r.db.SelectContext(ctx, &cells, cellsQuery, append(args, filter.Grid)...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get heatmap cells")
+		return nil, fmt.Errorf("failed to get heatmap cells: %w", err)
+	}
+	for _, cell := range cells {
+		byPath[cell.Path].Cells = append(byPath[cell.Path].Cells, cell)
+	}
+
+	selectorsQuery := heatmapPages + `
+		SELECT path, selector, clicks
+		FROM (
+			SELECT
+				h.path, h.selector, COUNT(*) AS clicks,
+				ROW_NUMBER() OVER (PARTITION BY h.path ORDER BY COUNT(*) DESC, h.selector) AS rank
+			FROM clicks h
+			WHERE ` + heatmapWhere + ` AND h.path IN (SELECT path FROM pages) AND h.selector IS NOT NULL
+			GROUP BY h.path, h.selector
+		) ranked
+		WHERE rank <= $6
+		ORDER BY path, rank
+	`
+
+	var selectorCounts []*domain.SelectorCount
+	if err := r.db.SelectContext(ctx, &selectorCounts, selectorsQuery, append(args, selectors)...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get heatmap selectors")
+		return nil, fmt.Errorf("failed to get heatmap selectors: %w", err)
+	}
+	for _, selector := range selectorCounts {
+		byPath[selector.Path].Selectors = append(byPath[selector.Path].Selectors, selector)
+	}
+
+	scrollQuery := heatmapPages + `
+		SELECT
+			h.path,
+			COUNT(*) AS pageviews,
+			percentile_cont(0.25) WITHIN GROUP (ORDER BY h.depth) AS p25,
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY h.depth) AS p50,
+			percentile_cont(0.75) WITHIN GROUP (ORDER BY h.depth) AS p75,
+			percentile_cont(0.9) WITHIN GROUP (ORDER BY h.depth) AS p90,
+			COUNT(*) FILTER (WHERE h.depth >= 25) AS reached_25,
+			COUNT(*) FILTER (WHERE h.depth >= 50) AS reached_50,
+			COUNT(*) FILTER (WHERE h.depth >= 75) AS reached_75,
+			COUNT(*) FILTER (WHERE h.depth >= 100) AS reached_100
+		FROM scroll_depths h
+		WHERE ` + heatmapWhere + ` AND h.path IN (SELECT path FROM pages)
+		GROUP BY h.path
+	`
+
+	var scrolls []*domain.ScrollDepth
+	if err := r.db.SelectContext(ctx, &scrolls, scrollQuery, args...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get scroll depth")
+		return nil, fmt.Errorf("failed to get scroll depth: %w", err)
+	}
+	for _, scroll := range scrolls {
+		byPath[scroll.Path].Scroll = scroll
+	}
+
+	return pages, nil
+}
+
+// SaveClientError adds an occurrence to the error group with the same
+// fingerprint, creating the group if needed. It reports whether the group is new.
+func (r *analyticsRepository) SaveClientError(ctx context.Context, group *domain.ErrorGroup, occurrence *domain.ErrorOccurrence) (bool, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "save_client_error",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Str("fingerprint", group.Fingerprint).Msg("Store client error in DB")
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to begin transaction")
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// xmax is 0 only for rows inserted, not updated, by this statement.
+	groupQuery := `
+		INSERT INTO error_groups (fingerprint, message, source, line, col, first_seen, last_seen)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $6)
+		ON CONFLICT (fingerprint) DO UPDATE SET
+			last_seen = GREATEST(error_groups.last_seen, EXCLUDED.last_seen),
+			count = error_groups.count + 1
+		RETURNING id, first_seen, last_seen, count, (xmax = 0) AS inserted
+	`
+
+	var row struct {
+		ID        int64     `db:"id"`
+		FirstSeen time.Time `db:"first_seen"`
+		LastSeen  time.Time `db:"last_seen"`
+		Count     int64     `db:"count"`
+		Inserted  bool      `db:"inserted"`
+	}
+	err = tx.GetContext(ctx, &row, groupQuery,
+		group.Fingerprint,
+		group.Message,
+		group.Source,
+		group.Line,
+		group.Column,
+		occurrence.Time,
+	)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to save error group")
+		return false, fmt.Errorf("failed to save error group: %w", err)
+	}
+	group.ID, group.FirstSeen, group.LastSeen, group.Count = row.ID, row.FirstSeen, row.LastSeen, row.Count
+	occurrence.GroupID = row.ID
+
+	occurrenceQuery := `
+		INSERT INTO error_occurrences (
+			group_id, session_id, path, message, stack, source, line, col,
+			browser, os, country, city, time
+			)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id
+	`
+
+	err = tx.GetContext(ctx, &occurrence.ID, occurrenceQuery,
+		occurrence.GroupID,
+		occurrence.SessionID,
+		occurrence.Path,
+		occurrence.Message,
+		occurrence.Stack,
+		occurrence.Source,
+		occurrence.Line,
+		occurrence.Column,
+		occurrence.Browser,
+		occurrence.OS,
+		occurrence.Country,
+		occurrence.City,
+		occurrence.Time,
+	)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to save error occurrence")
+		return false, fmt.Errorf("failed to save error occurrence: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error().Err(err).Msg("failed to commit client error")
+		return false, fmt.Errorf("failed to commit client error: %w", err)
+	}
+
+	return row.Inserted, nil
+}
+
+const errorGroupColumns = `
+	id, fingerprint, message,
+	COALESCE(source, '') AS source,
+	COALESCE(line, 0) AS line,
+	COALESCE(col, 0) AS col,
+	first_seen, last_seen, count
+`
+
+// ListErrorGroups returns error groups seen in the filter range, most
+// recently seen first.
+func (r *analyticsRepository) ListErrorGroups(ctx context.Context, filter *domain.AnalyticsFilter, limit, offset int) ([]*domain.ErrorGroup, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "list_error_groups",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get list of error groups")
+
+	query := `
+		SELECT ` + errorGroupColumns + `
+		FROM error_groups
+		WHERE last_seen >= ($1::timestamptz AT TIME ZONE 'UTC')
+			AND first_seen < ($2::timestamptz AT TIME ZONE 'UTC')
+		ORDER BY last_seen DESC, id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	groups := []*domain.ErrorGroup{}
+	if err := r.db.SelectContext(ctx, &groups, query, filter.From, filter.To, limit, offset); err != nil {
+		logger.Error().Err(err).Msg("Failed to list error groups")
+		return nil, fmt.Errorf("failed to list error groups: %w", err)
+	}
+
+	return groups, nil
+}
+
+// GetErrorGroup returns an error group with its latest occurrences.
+func (r *analyticsRepository) GetErrorGroup(ctx context.Context, id int64, occurrences int) (*domain.ErrorGroupDetail, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "get_error_group",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get error group")
+
+	query := `
+		SELECT ` + errorGroupColumns + `
+		FROM error_groups
+		WHERE id = $1
+	`
+
+	var detail domain.ErrorGroupDetail
+	if err := r.db.GetContext(ctx, &detail.ErrorGroup, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domain.ErrNotFound
+		}
+		logger.Error().Err(err).Msg("Failed to get error group")
+		return nil, fmt.Errorf("failed to get error group: %w", err)
+	}
+
+	occurrencesQuery := `
+		SELECT id, group_id,
+			COALESCE(session_id, '') AS session_id,
+			COALESCE(path, '') AS path,
+			message,
+			COALESCE(stack, '') AS stack,
+			COALESCE(source, '') AS source,
+			COALESCE(line, 0) AS line,
+			COALESCE(col, 0) AS col,
+			COALESCE(browser, '') AS browser,
+			COALESCE(os, '') AS os,
+			COALESCE(country, '') AS country,
+			COALESCE(city, '') AS city,
+			time
+		FROM error_occurrences
+		WHERE group_id = $1
+		ORDER BY time DESC, id DESC
+		LIMIT $2
+	`
+
+	detail.Occurrences = []*domain.ErrorOccurrence{}
+	if err := r.db.SelectContext(ctx, &detail.Occurrences, occurrencesQuery, id, occurrences); err != nil {
+		logger.Error().Err(err).Msg("Failed to get error occurrences")
+		return nil, fmt.Errorf("failed to get error occurrences: %w", err)
+	}
+
+	return &detail, nil
+}
+
+const insertEventQuery = `
+	INSERT INTO events (session_id, name, properties, time)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id
+`
+
+const insertPageviewQuery = `
+	INSERT INTO pageviews (session_id, path, title, time)
+	VALUES ($1, $2, $3, $4)
+`
+
+const insertLinkClickQuery = `
+	INSERT INTO link_clicks (session_id, kind, url, host, page, time)
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+`
+
+// SaveEvents stores a batch of events in a single transaction.
+// Pageview events are also written to the pageviews table, outbound link
+// and download events to the link_clicks table.
+func (r *analyticsRepository) SaveEvents(ctx context.Context, events []*domain.Event) error {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "save_events",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Int("count", len(events)).Msg("Store events batch in DB")
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PreparexContext(ctx, insertEventQuery)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to prepare event insert")
+		return fmt.Errorf("failed to prepare event insert: %w", err)
+	}
+	defer stmt.Close()
+
+	pageviewStmt, err := tx.PreparexContext(ctx, insertPageviewQuery)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to prepare pageview insert")
+		return fmt.Errorf("failed to prepare pageview insert: %w", err)
+	}
+	defer pageviewStmt.Close()
+
+	linkStmt, err := tx.PreparexContext(ctx, insertLinkClickQuery)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to prepare link click insert")
+		return fmt.Errorf("failed to prepare link click insert: %w", err)
+	}
+	defer linkStmt.Close()
+
+	for _, event := range events {
+		properties, err := json.Marshal(event.Properties)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to encode event properties")
+			return fmt.Errorf("failed to encode event properties: %w", err)
+		}
+
+		err = stmt.GetContext(ctx, &event.ID,
+			event.SessionID,
+			event.Name,
+			properties,
+			event.Timestamp,
+		)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to save event")
+			return fmt.Errorf("failed to save event: %w", err)
+		}
+
+		if event.Name == domain.EventPageview {
+			path, _ := event.Properties["path"].(string)
+			title, _ := event.Properties["title"].(string)
+			if _, err := pageviewStmt.ExecContext(ctx, event.SessionID, path, title, event.Timestamp); err != nil {
+				logger.Error().Err(err).Msg("failed to save pageview")
+				return fmt.Errorf("failed to save pageview: %w", err)
+			}
+		}
+
+		if event.Name == domain.EventOutbound || event.Name == domain.EventDownload {
+			link, _ := event.Properties["url"].(string)
+			page, _ := event.Properties["path"].(string)
+			if _, err := linkStmt.ExecContext(ctx, event.SessionID, event.Name, link, linkHost(link), page, event.Timestamp); err != nil {
+				logger.Error().Err(err).Msg("failed to save link click")
+				return fmt.Errorf("failed to save link click: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error().Err(err).Msg("failed to commit events batch")
+		return fmt.Errorf("failed to commit events batch: %w", err)
+	}
+
+	logger.Info().Msg("events batch saved successfully")
+
+	return nil
+}
+
+// linkHost returns the host a link points to, without port and "www.".
+func linkHost(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// linksWhere restricts link_clicks rows (aliased l) to the range of a filter
+// and, unless bots are included, to sessions not flagged as bots.
+func linksWhere(filter *domain.AnalyticsFilter) string {
+	clause := `
+		l.time >= ($1::timestamptz AT TIME ZONE 'UTC')
+		AND l.time < ($2::timestamptz AT TIME ZONE 'UTC')
+	`
+	if !filter.IncludeBots {
+		clause += ` AND NOT EXISTS (
+			SELECT 1 FROM sessions s
+			WHERE s.session_id = l.session_id AND s.is_bot
+		)`
+	}
+	return clause
+}
+
+// GetLinks returns the most clicked outbound hosts, outbound URLs and
+// downloads, and the downloads of the top files per interval bucket.
+func (r *analyticsRepository) GetLinks(ctx context.Context, filter *domain.AnalyticsFilter, limit int) (*domain.LinksReport, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "links",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get outbound links and downloads")
+
+	where := linksWhere(filter)
+	args := []any{filter.From, filter.To}
+	report := &domain.LinksReport{}
+
+	destinationsQuery := `
+		SELECT l.host, COUNT(*) AS clicks, COUNT(DISTINCT l.session_id) AS visitors
+		FROM link_clicks l
+		WHERE ` + where + ` AND l.kind = $3
+		GROUP BY l.host
+		ORDER BY clicks DESC, l.host
+		LIMIT $4
+	`
+
+	report.Destinations = []*domain.DestinationItem{}
+	if err := r.db.SelectContext(ctx, &report.Destinations, destinationsQuery, append(args, domain.EventOutbound, limit)...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get outbound destinations")
+		return nil, fmt.Errorf("failed to get outbound destinations: %w", err)
+	}
+
+	linksQuery := `
+		SELECT l.url, COUNT(*) AS clicks, COUNT(DISTINCT l.session_id) AS visitors
+		FROM link_clicks l
+		WHERE ` + where + ` AND l.kind = $3
+		GROUP BY l.url
+		ORDER BY clicks DESC, l.url
+		LIMIT $4
+	`
+
+	report.OutboundLinks = []*domain.LinkItem{}
+	if err := r.db.SelectContext(ctx, &report.OutboundLinks, linksQuery, append(args, domain.EventOutbound, limit)...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get outbound links")
+		return nil, fmt.Errorf("failed to get outbound links: %w", err)
+	}
+
+	report.Downloads = []*domain.LinkItem{}
+	if err := r.db.SelectContext(ctx, &report.Downloads, linksQuery, append(args, domain.EventDownload, limit)...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get downloads")
+		return nil, fmt.Errorf("failed to get downloads: %w", err)
+	}
+
+	seriesQuery := `
+		WITH top AS (
+			SELECT l.url
+			FROM link_clicks l
+			WHERE ` + where + ` AND l.kind = $3
+			GROUP BY l.url
+			ORDER BY COUNT(*) DESC, l.url
+			LIMIT $4
+		)
+		SELECT
+			date_trunc($5, l.time AT TIME ZONE 'UTC' AT TIME ZONE $6) AT TIME ZONE $6 AS bucket,
+			l.url,
+			COUNT(*) AS downloads
+		FROM link_clicks l
+		WHERE ` + where + ` AND l.kind = $3 AND l.url IN (SELECT url FROM top)
+		GROUP BY 1, l.url
+		ORDER BY 1, downloads DESC, l.url
+	`
+
+	report.DownloadSeries = []*domain.DownloadBucket{}
+	seriesArgs := append(args, domain.EventDownload, limit, filter.Interval, filter.Timezone)
+	if err := r.db.SelectContext(ctx, &report.DownloadSeries, seriesQuery, seriesArgs...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get download series")
+		return nil, fmt.Errorf("failed to get download series: %w", err)
+	}
+
+	return report, nil
+}
+
+// eventRow is the DB representation of domain.Event, with properties kept as raw JSONB.
+type eventRow struct {
+	ID         int64     `db:"id"`
+	SessionID  string    `db:"session_id"`
+	Name       string    `db:"name"`
+	Properties []byte    `db:"properties"`
+	Time       time.Time `db:"time"`
+}
+
+func (r *analyticsRepository) ListEvents(ctx context.Context, filter *domain.EventFilter) ([]*domain.Event, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_repository",
+			"method":     "list_events",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("Get list of events")
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100 // default limit
+	}
+	if limit > 1000 {
+		limit = 1000 // max limit
+	}
+	offset := filter.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	var conditions []string
+	var args []any
+	if filter.SessionID != "" {
+		args = append(args, filter.SessionID)
+		conditions = append(conditions, fmt.Sprintf("session_id = $%d", len(args)))
+	}
+	if filter.UserID != "" {
+		args = append(args, filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("session_id IN (SELECT session_id FROM visits WHERE user_id = $%d)", len(args)))
+	}
+	if filter.Name != "" {
+		args = append(args, filter.Name)
+		conditions = append(conditions, fmt.Sprintf("name = $%d", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// A single session or user is returned in the order the events happened,
+	// everything else newest first.
+	order := "time DESC, id DESC"
+	if filter.SessionID != "" || filter.UserID != "" {
+		order = "time ASC, id ASC"
+	}
+
+	args = append(args, limit, offset)
+	query := fmt.Sprintf(`
+		SELECT id, session_id, name, properties, time
+		FROM events
+		%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, where, order, len(args)-1, len(args))
+
+	var rows []eventRow
+	err := r.db.SelectContext(ctx, &rows, query, args...)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list events")
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	events := make([]*domain.Event, 0, len(rows))
+	for _, row := range rows {
+		event := &domain.Event{
+			ID:        row.ID,
+			SessionID: row.SessionID,
+			Name:      row.Name,
+			Timestamp: row.Time,
+		}
+		if err := json.Unmarshal(row.Properties, &event.Properties); err != nil {
+			logger.Error().Err(err).Int64("event_id", row.ID).Msg("failed to decode event properties")
+			return nil, fmt.Errorf("failed to decode event properties: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	logger.Info().Msg("got events successfully")
+
+	return events, nil
+}
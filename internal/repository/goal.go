@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ramisoul84/emil-server/internal/domain"
+	"github.com/ramisoul84/emil-server/pkg/logger"
+)
+
+type goalRepository struct {
+	db     *sqlx.DB
+	logger logger.Logger
+}
+
+func NewGoalRepository(db *sqlx.DB) *goalRepository {
+	return &goalRepository{db, logger.Get()}
+}
+
+// goalTimeExprs select, for a visit (aliased v), the earliest time the
+// session completed a goal of the given type strictly after %[2]s, or NULL.
+// %[1]s, where present, is the placeholder of the goal's match value.
+var goalTimeExprs = map[string]string{
+	domain.GoalTypeAction: `(
+		SELECT MIN(a.first_seen) FROM visit_actions a
+		WHERE a.session_id = v.session_id AND a.name = %[1]s AND a.first_seen > %[2]s
+	)`,
+	domain.GoalTypeEvent: `(
+		SELECT MIN(e.time) FROM events e
+		WHERE e.session_id = v.session_id AND e.name = %[1]s AND e.time > %[2]s
+	)`,
+	domain.GoalTypePageview: `(
+		SELECT MIN(t) FROM (
+			SELECT v.start_time AS t WHERE v.landing_page = %[1]s
+			UNION ALL
+			SELECT p.time FROM pageviews p
+			WHERE p.session_id = v.session_id AND p.path = %[1]s
+		) viewed
+		WHERE t > %[2]s
+	)`,
+	domain.GoalTypeMessage: `(
+		SELECT MIN(m.time) FROM messages m
+		WHERE m.user_id = v.user_id
+			AND m.time >= v.start_time
+			AND (v.duration IS NULL OR m.time <= v.start_time + v.duration * INTERVAL '1 second')
+			AND m.time > %[2]s
+	)`,
+}
+
+func (r *goalRepository) Create(ctx context.Context, goal *domain.Goal) error {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_repository",
+			"method":     "create_goal",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Msg("Store goal in DB")
+
+	query := `
+		INSERT INTO goals (name, type, match, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	err := r.db.GetContext(ctx, &goal.ID, query, goal.Name, goal.Type, goal.Match, goal.CreatedAt)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to save goal")
+		return fmt.Errorf("failed to save goal: %w", err)
+	}
+
+	return nil
+}
+
+func (r *goalRepository) Get(ctx context.Context, id int) (*domain.Goal, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_repository",
+			"method":     "get_goal",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Msg("get goal from DB")
+
+	query := `
+		SELECT id, name, type, match, created_at
+		FROM goals
+		WHERE id = $1
+	`
+
+	var goal domain.Goal
+	err := r.db.GetContext(ctx, &goal, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Info().Msg("goal not found")
+			return nil, domain.ErrNotFound
+		}
+		logger.Error().Err(err).Msg("failed to get goal")
+		return nil, domain.ErrInternal
+	}
+
+	return &goal, nil
+}
+
+func (r *goalRepository) Update(ctx context.Context, goal *domain.Goal) error {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_repository",
+			"method":     "update_goal",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Msg("update goal")
+
+	query := `
+		UPDATE goals
+		SET name = $2, type = $3, match = $4
+		WHERE id = $1
+		RETURNING created_at
+	`
+
+	err := r.db.GetContext(ctx, &goal.CreatedAt, query, goal.ID, goal.Name, goal.Type, goal.Match)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Info().Msg("goal not found")
+			return domain.ErrNotFound
+		}
+		logger.Error().Err(err).Msg("failed to update goal")
+		return domain.ErrInternal
+	}
+
+	return nil
+}
+
+func (r *goalRepository) Delete(ctx context.Context, id int) error {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_repository",
+			"method":     "delete_goal",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Msg("delete goal from DB")
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM goals WHERE id = $1`, id)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to delete goal")
+		return domain.ErrInternal
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		logger.Info().Msg("goal not found")
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *goalRepository) List(ctx context.Context) ([]*domain.Goal, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_repository",
+			"method":     "list_goals",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Msg("list goals")
+
+	query := `
+		SELECT id, name, type, match, created_at
+		FROM goals
+		ORDER BY id
+	`
+
+	goals := []*domain.Goal{}
+	if err := r.db.SelectContext(ctx, &goals, query); err != nil {
+		logger.Error().Err(err).Msg("failed to list goals")
+		return nil, domain.ErrInternal
+	}
+
+	return goals, nil
+}
+
+// GetFunnel counts the sessions in the filter range and, for each step, the
+// sessions that completed that goal after completing every goal before it,
+// in order.
+func (r *goalRepository) GetFunnel(ctx context.Context, filter *domain.AnalyticsFilter, goals []*domain.Goal) (int, []int, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_repository",
+			"method":     "funnel",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Int("steps", len(goals)).Msg("Get funnel")
+
+	where, args, err := visitsWhere(filter)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Each step is a lateral join holding when the session reached it, or
+	// NULL, looked up from the time the previous step was reached.
+	columns := []string{"COUNT(*)"}
+	joins := make([]string, 0, len(goals))
+	previous := "'-infinity'::timestamp"
+	for i, goal := range goals {
+		expr, ok := goalTimeExprs[goal.Type]
+		if !ok {
+			return 0, nil, fmt.Errorf("unknown goal type %q", goal.Type)
+		}
+		var match string
+		if strings.Contains(expr, "%[1]s") {
+			args = append(args, goal.Match)
+			match = fmt.Sprintf("$%d", len(args))
+		}
+		step := fmt.Sprintf("step%d", i+1)
+		joins = append(joins, fmt.Sprintf("LEFT JOIN LATERAL (SELECT %s AS at) %s ON true", fmt.Sprintf(expr, match, previous), step))
+		columns = append(columns, "COUNT("+step+".at)")
+		previous = step + ".at"
+	}
+
+	query := `
+		SELECT ` + strings.Join(columns, ",\n\t\t\t") + `
+		FROM visits v
+		` + strings.Join(joins, "\n\t\t") + `
+		WHERE ` + where
+
+	counts := make([]int, len(columns))
+	dest := make([]any, len(counts))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+
+	if err := r.db.QueryRowxContext(ctx, query, args...).Scan(dest...); err != nil {
+		logger.Error().Err(err).Msg("Failed to get funnel")
+		return 0, nil, fmt.Errorf("failed to get funnel: %w", err)
+	}
+
+	return counts[0], counts[1:], nil
+}
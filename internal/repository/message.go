@@ -32,9 +32,13 @@ func (r *messageRepository) Create(ctx context.Context, message *domain.Message)
 	query := `
             INSERT INTO messages (
 				user_id, name, email, text,
-				time, unread, ip, city, country
+				time, unread, ip, city, country,
+				country_code, region, latitude, longitude, geo_timezone, asn, isp
+				)
+            VALUES (
+				$1, $2, $3, $4, $5, $6, $7, $8, $9,
+				NULLIF($10, ''), NULLIF($11, ''), $12, $13, NULLIF($14, ''), NULLIF($15, 0), NULLIF($16, '')
 				)
-            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		`
 
 	_, err := r.db.ExecContext(ctx, query,
@@ -47,6 +51,13 @@ func (r *messageRepository) Create(ctx context.Context, message *domain.Message)
 		message.IP,
 		message.City,
 		message.Country,
+		message.CountryCode,
+		message.Region,
+		message.Latitude,
+		message.Longitude,
+		message.GeoTimezone,
+		message.ASN,
+		message.ISP,
 	)
 
 	if err != nil {
@@ -59,6 +70,20 @@ func (r *messageRepository) Create(ctx context.Context, message *domain.Message)
 	return nil
 }
 
+// messageColumns reads a message with NULL columns as zero values.
+const messageColumns = `
+	id, COALESCE(user_id, '') AS user_id, name, email, text, time, unread,
+	COALESCE(ip, '') AS ip,
+	COALESCE(city, '') AS city,
+	COALESCE(country, '') AS country,
+	COALESCE(country_code, '') AS country_code,
+	COALESCE(region, '') AS region,
+	latitude, longitude,
+	COALESCE(geo_timezone, '') AS geo_timezone,
+	COALESCE(asn, 0) AS asn,
+	COALESCE(isp, '') AS isp
+`
+
 func (r *messageRepository) Get(ctx context.Context, id int) (*domain.Message, error) {
 	logger := r.logger.WithFields(
 		map[string]any{
@@ -70,8 +95,8 @@ func (r *messageRepository) Get(ctx context.Context, id int) (*domain.Message, e
 	logger.Info().Msg("get message from DB")
 
 	query := `
-		SELECT *
-		FROM messaages 
+		SELECT ` + messageColumns + `
+		FROM messages
 		WHERE id = $1
 	`
 
@@ -168,7 +193,7 @@ func (r *messageRepository) List(ctx context.Context, limit, offset int) ([]*dom
 	logger.Info().Msg("list messages")
 
 	query := `
-		SELECT *
+		SELECT ` + messageColumns + `
 		FROM messages
 		ORDER BY time DESC
 		LIMIT $1 OFFSET $2
@@ -191,3 +216,31 @@ func (r *messageRepository) List(ctx context.Context, limit, offset int) ([]*dom
 
 	return messages, total, nil
 }
+
+// ListByUser returns the messages sent by a user, oldest first.
+func (r *messageRepository) ListByUser(ctx context.Context, userID string) ([]*domain.Message, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "message_repository",
+			"method":     "list_user_messages",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+	logger.Info().Msg("list messages of user")
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE user_id = $1
+		ORDER BY time
+	`
+
+	messages := []*domain.Message{}
+	err := r.db.SelectContext(ctx, &messages, query, userID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list user messages")
+		return nil, domain.ErrInternal
+	}
+
+	return messages, nil
+}
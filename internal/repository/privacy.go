@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ramisoul84/emil-server/internal/domain"
+	"github.com/ramisoul84/emil-server/pkg/logger"
+)
+
+type privacyRepository struct {
+	db     *sqlx.DB
+	logger logger.Logger
+}
+
+func NewPrivacyRepository(db *sqlx.DB) *privacyRepository {
+	return &privacyRepository{db, logger.Get()}
+}
+
+// ListIPs returns up to limit rows of table with an IP and an id greater
+// than afterID, in id order.
+func (r *privacyRepository) ListIPs(ctx context.Context, table string, afterID int64, limit int) ([]*domain.StoredIP, error) {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "privacy_repository",
+			"method":     "list_ips",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	if !slices.Contains(domain.IPTables, table) {
+		return nil, fmt.Errorf("%w: table %q has no IPs", domain.ErrValidation, table)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, ip
+		FROM %s
+		WHERE id > $1 AND ip IS NOT NULL AND ip <> ''
+		ORDER BY id
+		LIMIT $2
+	`, table)
+
+	ips := []*domain.StoredIP{}
+	if err := r.db.SelectContext(ctx, &ips, query, afterID, limit); err != nil {
+		logger.Error().Err(err).Str("table", table).Msg("failed to list IPs")
+		return nil, fmt.Errorf("failed to list IPs: %w", err)
+	}
+
+	return ips, nil
+}
+
+// UpdateIPs overwrites the IP of the given rows of table in one transaction.
+func (r *privacyRepository) UpdateIPs(ctx context.Context, table string, ips []*domain.StoredIP) error {
+	logger := r.logger.WithFields(
+		map[string]any{
+			"layer":      "privacy_repository",
+			"method":     "update_ips",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	if !slices.Contains(domain.IPTables, table) {
+		return fmt.Errorf("%w: table %q has no IPs", domain.ErrValidation, table)
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to begin transaction")
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`UPDATE %s SET ip = $1 WHERE id = $2`, table)
+	for _, ip := range ips {
+		if _, err := tx.ExecContext(ctx, query, ip.IP, ip.ID); err != nil {
+			logger.Error().Err(err).Str("table", table).Msg("failed to update IP")
+			return fmt.Errorf("failed to update IP: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error().Err(err).Msg("failed to commit transaction")
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -1,7 +1,15 @@
 package handler
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/ramisoul84/emil-server/internal/domain"
@@ -10,10 +18,53 @@ import (
 type analyticsService interface {
 	VisitStart(ctx context.Context, data *domain.VisitStartData) error
 	VisitEnd(ctx context.Context, data *domain.VisitData) error
+	Heartbeat(ctx context.Context, data *domain.HeartbeatData) error
+	SubscribeLive() (<-chan domain.LiveEvent, func())
+	ActiveVisitors(ctx context.Context) (int, error)
 	ListVisits(ctx context.Context, limit, offset int) ([]*domain.Data, error)
-	VisitStats(ctx context.Context) (*domain.Stats, error)
+	VisitStats(ctx context.Context, filter *domain.AnalyticsFilter) (*domain.StatsReport, error)
+	Breakdown(ctx context.Context, filter *domain.AnalyticsFilter, dimension string, limit int) ([]*domain.BreakdownItem, error)
+	Campaigns(ctx context.Context, filter *domain.AnalyticsFilter) ([]*domain.CampaignItem, error)
+	TopPages(ctx context.Context, filter *domain.AnalyticsFilter, limit int) ([]*domain.PageItem, error)
+	Cohorts(ctx context.Context, filter *domain.AnalyticsFilter, weeks int) (*domain.CohortReport, error)
+	VisitorProfile(ctx context.Context, userID string) (*domain.VisitorProfile, error)
+	TrackVitals(ctx context.Context, data *domain.VitalsData) error
+	WebVitals(ctx context.Context, filter *domain.VitalsFilter) (*domain.VitalsReport, error)
+	TrackInteractions(ctx context.Context, data *domain.InteractionData) error
+	Heatmap(ctx context.Context, filter *domain.HeatmapFilter) (*domain.HeatmapReport, error)
+	TrackError(ctx context.Context, data *domain.ClientErrorData) error
+	ListErrorGroups(ctx context.Context, filter *domain.AnalyticsFilter, limit, offset int) ([]*domain.ErrorGroup, error)
+	GetErrorGroup(ctx context.Context, id int64) (*domain.ErrorGroupDetail, error)
+	TrackEvent(ctx context.Context, event *domain.Event) error
+	TrackEvents(ctx context.Context, events []*domain.Event) (*domain.BatchResult, error)
+	ListEvents(ctx context.Context, filter *domain.EventFilter) ([]*domain.Event, error)
+	Links(ctx context.Context, filter *domain.AnalyticsFilter, limit int) (*domain.LinksReport, error)
 }
 
+const (
+	// maxBatchSize is the maximum number of events accepted in one batch request.
+	maxBatchSize = 100
+
+	// liveActiveInterval is how often the live stream refreshes the active visitor count.
+	liveActiveInterval = 15 * time.Second
+	// liveWriteTimeout bounds every write to a live stream. The server-wide
+	// write timeout would otherwise cut long-lived streams.
+	liveWriteTimeout = 30 * time.Second
+
+	// defaultReportRange is used when a report request has no from parameter.
+	defaultReportRange = 30 * 24 * time.Hour
+
+	// defaultCohortWeeks and maxCohortWeeks bound the weeks parameter of the cohort report.
+	defaultCohortWeeks = 8
+	maxCohortWeeks     = 52
+
+	// defaultHeatmapGrid, minHeatmapGrid and maxHeatmapGrid bound the grid
+	// parameter of the heatmap report, in cells per axis.
+	defaultHeatmapGrid = 20
+	minHeatmapGrid     = 2
+	maxHeatmapGrid     = 100
+)
+
 type analyticsHandler struct {
 	service analyticsService
 }
@@ -29,7 +80,7 @@ func (h *analyticsHandler) VisitStart(c *fiber.Ctx) error {
 	ip := c.Locals("ip").(string)
 
 	var data domain.VisitStartData
-	if err := c.BodyParser(&data); err != nil {
+	if err := parseBeaconBody(c, &data); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
@@ -39,9 +90,7 @@ func (h *analyticsHandler) VisitStart(c *fiber.Ctx) error {
 	ctx = context.WithValue(ctx, "request_id", requestId)
 
 	if err := h.service.VisitStart(ctx, &data); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to process visit",
-		})
+		return ingestError(c, err, "Failed to process visit")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -54,7 +103,7 @@ func (h *analyticsHandler) VisitEnd(c *fiber.Ctx) error {
 	ip := c.Locals("ip").(string)
 
 	var data domain.VisitData
-	if err := c.BodyParser(&data); err != nil {
+	if err := parseBeaconBody(c, &data); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
@@ -64,16 +113,149 @@ func (h *analyticsHandler) VisitEnd(c *fiber.Ctx) error {
 	ctx = context.WithValue(ctx, "request_id", requestId)
 
 	if err := h.service.VisitEnd(ctx, &data); err != nil {
+		return ingestError(c, err, "Failed to handle visit end")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Visit end tracked",
+	})
+}
+
+func (h *analyticsHandler) Heartbeat(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	var data domain.HeartbeatData
+	if err := parseBeaconBody(c, &data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+
+	if err := h.service.Heartbeat(ctx, &data); err != nil {
+		switch {
+		case errors.Is(err, domain.ErrValidation):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		case errors.Is(err, domain.ErrNotFound):
+			// The client should start a new session.
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Session not found or already ended",
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to record heartbeat",
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Heartbeat recorded",
+	})
+}
+
+// Live streams visit events and the active visitor count as Server-Sent Events.
+func (h *analyticsHandler) Live(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	// The request context is not usable once the stream writer runs.
+	ctx := context.WithValue(context.Background(), "request_id", requestId)
+
+	events, unsubscribe := h.service.SubscribeLive()
+	conn := c.Context().Conn()
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		ticker := time.NewTicker(liveActiveInterval)
+		defer ticker.Stop()
+
+		fmt.Fprintf(w, "retry: %d\n\n", (5 * time.Second).Milliseconds())
+		if err := h.writeActive(ctx, w, conn); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := writeSSE(w, conn, event.Type, event); err != nil {
+					return
+				}
+			case <-ticker.C:
+				if err := h.writeActive(ctx, w, conn); err != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+// Active returns the number of visitors currently on the site.
+func (h *analyticsHandler) Active(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	active, err := h.service.ActiveVisitors(ctx)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to handle visit end",
+			"error": "Failed to get active visitors",
 		})
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Visit end tracked",
+		"active": active,
 	})
 }
 
+func (h *analyticsHandler) writeActive(ctx context.Context, w *bufio.Writer, conn net.Conn) error {
+	active, err := h.service.ActiveVisitors(ctx)
+	if err != nil {
+		// Keep the stream open, the next tick may succeed.
+		return writeSSEComment(w, conn, "active count unavailable")
+	}
+
+	return writeSSE(w, conn, "active", fiber.Map{"active": active})
+}
+
+func writeSSE(w *bufio.Writer, conn net.Conn, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+
+	return flushSSE(w, conn)
+}
+
+func writeSSEComment(w *bufio.Writer, conn net.Conn, comment string) error {
+	fmt.Fprintf(w, ": %s\n\n", comment)
+
+	return flushSSE(w, conn)
+}
+
+func flushSSE(w *bufio.Writer, conn net.Conn) error {
+	if conn != nil {
+		if err := conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout)); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
 func (h *analyticsHandler) List(c *fiber.Ctx) error {
 	requestId := c.Locals("request_id").(string)
 
@@ -92,13 +274,27 @@ func (h *analyticsHandler) List(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(list)
 }
 
+// Stats returns a stats time series for ?from=&to=&interval=&tz=, compared
+// against the previous period of the same length.
 func (h *analyticsHandler) Stats(c *fiber.Ctx) error {
 	requestId := c.Locals("request_id").(string)
 
+	filter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	ctx := context.WithValue(c.Context(), "request_id", requestId)
-	stats, err := h.service.VisitStats(ctx)
+	stats, err := h.service.VisitStats(ctx, filter)
 
 	if err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get stats",
 		})
@@ -106,3 +302,672 @@ func (h *analyticsHandler) Stats(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).JSON(stats)
 }
+
+// Breakdown returns the top values of ?dimension= for the filter range.
+func (h *analyticsHandler) Breakdown(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	filter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	dimension := c.Query("dimension")
+	if dimension == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "dimension is required",
+		})
+	}
+
+	limit, err := parseLimit(c, 10, 100)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	items, err := h.service.Breakdown(ctx, filter, dimension, limit)
+	if err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get breakdown",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"dimension": dimension,
+		"items":     items,
+	})
+}
+
+// Campaigns reports visits per utm campaign for the filter range.
+func (h *analyticsHandler) Campaigns(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	filter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	campaigns, err := h.service.Campaigns(ctx, filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get campaigns",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(campaigns)
+}
+
+// Pages reports the top pages for the filter range, of the visits matching
+// its drill-down filters.
+func (h *analyticsHandler) Pages(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	filter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	limit, err := parseLimit(c, 20, 100)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	pages, err := h.service.TopPages(ctx, filter, limit)
+	if err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get top pages",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(pages)
+}
+
+// Cohorts returns the weekly retention matrix. Without from, the range
+// covers the requested number of weeks.
+func (h *analyticsHandler) Cohorts(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	filter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	weeks := defaultCohortWeeks
+	if weeksString := c.Query("weeks"); weeksString != "" {
+		weeks, err = strconv.Atoi(weeksString)
+		if err != nil || weeks <= 0 || weeks > maxCohortWeeks {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("weeks must be a positive integer between 1 and %d", maxCohortWeeks),
+			})
+		}
+	}
+	if c.Query("from") == "" {
+		filter.From = filter.To.AddDate(0, 0, -7*weeks)
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	report, err := h.service.Cohorts(ctx, filter, weeks)
+	if err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get cohorts",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+func (h *analyticsHandler) Profile(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	userID := c.Params("user_id")
+	if userID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "user_id is required",
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	profile, err := h.service.VisitorProfile(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Visitor not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get visitor profile",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(profile)
+}
+
+// TrackVitals accepts the metrics of one page view, also as a beacon.
+func (h *analyticsHandler) TrackVitals(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	var data domain.VitalsData
+	if err := parseBeaconBody(c, &data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+
+	if err := h.service.TrackVitals(ctx, &data); err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to track web vitals",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Web vitals tracked",
+	})
+}
+
+func (h *analyticsHandler) Vitals(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	analyticsFilter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	filter := domain.VitalsFilter{
+		Path:       c.Query("path"),
+		DeviceType: analyticsFilter.Filters[domain.DimensionDeviceType],
+	}
+	delete(analyticsFilter.Filters, domain.DimensionDeviceType)
+	filter.AnalyticsFilter = *analyticsFilter
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	report, err := h.service.WebVitals(ctx, &filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get web vitals",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+// TrackInteractions accepts the clicks and scroll depth of one page view,
+// also as a beacon.
+func (h *analyticsHandler) TrackInteractions(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	var data domain.InteractionData
+	if err := parseBeaconBody(c, &data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+
+	if err := h.service.TrackInteractions(ctx, &data); err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to track interactions",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Interactions tracked",
+	})
+}
+
+func (h *analyticsHandler) Heatmap(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	analyticsFilter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	limit, err := parseLimit(c, 10, 50)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	grid := c.QueryInt("grid", defaultHeatmapGrid)
+	if grid < minHeatmapGrid || grid > maxHeatmapGrid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("grid must be an integer between %d and %d", minHeatmapGrid, maxHeatmapGrid),
+		})
+	}
+
+	filter := domain.HeatmapFilter{
+		Path:       c.Query("path"),
+		DeviceType: analyticsFilter.Filters[domain.DimensionDeviceType],
+		Grid:       grid,
+		Limit:      limit,
+	}
+	delete(analyticsFilter.Filters, domain.DimensionDeviceType)
+	filter.AnalyticsFilter = *analyticsFilter
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	report, err := h.service.Heatmap(ctx, &filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get heatmap",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+// TrackError accepts a frontend JavaScript error, also as a beacon.
+func (h *analyticsHandler) TrackError(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+	ip := c.Locals("ip").(string)
+
+	var data domain.ClientErrorData
+	if err := parseBeaconBody(c, &data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "ip", ip)
+	ctx = context.WithValue(ctx, "request_id", requestId)
+
+	if err := h.service.TrackError(ctx, &data); err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return ingestError(c, err, "Failed to track error")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Error tracked",
+	})
+}
+
+func (h *analyticsHandler) Errors(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	filter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	limit, err := parseLimit(c, 20, 100)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "offset must be a non-negative integer",
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	groups, err := h.service.ListErrorGroups(ctx, filter, limit, offset)
+	if err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list errors",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(groups)
+}
+
+func (h *analyticsHandler) ErrorGroup(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "id must be an integer",
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	group, err := h.service.GetErrorGroup(ctx, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Error group not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get error group",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(group)
+}
+
+func (h *analyticsHandler) TrackEvent(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	var event domain.Event
+	if err := c.BodyParser(&event); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+
+	if err := h.service.TrackEvent(ctx, &event); err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to track event",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Event tracked",
+		"id":      event.ID,
+	})
+}
+
+// TrackEvents ingests a JSON array of events. It also accepts text/plain
+// bodies, which is what navigator.sendBeacon sends for string payloads.
+func (h *analyticsHandler) TrackEvents(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	var raw []json.RawMessage
+	if err := parseBeaconBody(c, &raw); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body, expected an array of events",
+		})
+	}
+
+	if len(raw) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Batch must contain at least one event",
+		})
+	}
+
+	if len(raw) > maxBatchSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "Batch must contain at most " + strconv.Itoa(maxBatchSize) + " events",
+		})
+	}
+
+	// Decode events one by one so a malformed event only rejects itself.
+	events := make([]*domain.Event, len(raw))
+	for i, item := range raw {
+		var event domain.Event
+		if err := json.Unmarshal(item, &event); err != nil {
+			continue
+		}
+		events[i] = &event
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+
+	result, err := h.service.TrackEvents(ctx, events)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to track events",
+		})
+	}
+
+	status := fiber.StatusOK
+	switch {
+	case result.Accepted == 0:
+		status = fiber.StatusBadRequest
+	case result.Rejected > 0:
+		status = fiber.StatusMultiStatus
+	}
+
+	return c.Status(status).JSON(result)
+}
+
+func (h *analyticsHandler) Events(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	filter := domain.EventFilter{
+		SessionID: c.Query("session_id"),
+		UserID:    c.Query("user_id"),
+		Name:      c.Query("name"),
+	}
+
+	if limitString := c.Query("limit"); limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit <= 0 || limit > 1000 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "limit must be a positive integer between 1 and 1000",
+			})
+		}
+		filter.Limit = limit
+	}
+
+	if offsetString := c.Query("offset"); offsetString != "" {
+		offset, err := strconv.Atoi(offsetString)
+		if err != nil || offset < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "offset must be a non-negative integer",
+			})
+		}
+		filter.Offset = offset
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	events, err := h.service.ListEvents(ctx, &filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get events",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(events)
+}
+
+// Links reports outbound link clicks and downloads.
+func (h *analyticsHandler) Links(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	filter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	limit, err := parseLimit(c, 10, 100)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	report, err := h.service.Links(ctx, filter, limit)
+	if err != nil {
+		if errors.Is(err, domain.ErrValidation) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get links",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+// parseAnalyticsFilter reads the from, to, interval and tz query parameters
+// and one drill-down filter per breakdown dimension, e.g. ?country=Germany.
+// from and to accept RFC 3339 timestamps or dates, dates are read in tz and
+// to is inclusive. The range defaults to the last 30 days.
+func parseAnalyticsFilter(c *fiber.Ctx) (*domain.AnalyticsFilter, error) {
+	filter := &domain.AnalyticsFilter{
+		Interval:    c.Query("interval", domain.IntervalDay),
+		Timezone:    c.Query("tz", "UTC"),
+		Filters:     map[string]string{},
+		IncludeBots: c.QueryBool("include_bots"),
+	}
+
+	for _, dimension := range domain.BreakdownDimensions {
+		if value := c.Query(dimension); value != "" {
+			filter.Filters[dimension] = value
+		}
+	}
+
+	loc, err := time.LoadLocation(filter.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", filter.Timezone)
+	}
+
+	filter.To = time.Now()
+	if to := c.Query("to"); to != "" {
+		t, dateOnly, err := parseReportTime(to, loc)
+		if err != nil {
+			return nil, fmt.Errorf("to must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.To = t
+	}
+
+	filter.From = filter.To.Add(-defaultReportRange)
+	if from := c.Query("from"); from != "" {
+		t, _, err := parseReportTime(from, loc)
+		if err != nil {
+			return nil, fmt.Errorf("from must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+		}
+		filter.From = t
+	}
+
+	return filter, nil
+}
+
+// parseLimit reads the limit query parameter, bounded to [1, max].
+func parseLimit(c *fiber.Ctx, defaultLimit, max int) (int, error) {
+	limitString := c.Query("limit")
+	if limitString == "" {
+		return defaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(limitString)
+	if err != nil || limit <= 0 || limit > max {
+		return 0, fmt.Errorf("limit must be a positive integer between 1 and %d", max)
+	}
+
+	return limit, nil
+}
+
+func parseReportTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, loc); err == nil {
+		return t, true, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// ingestError maps errors of the asynchronous ingest pipeline to responses.
+// A full queue is reported as 429 so clients back off and retry.
+func ingestError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, domain.ErrQueueFull):
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Too many requests, try again later",
+		})
+	case errors.Is(err, domain.ErrShuttingDown):
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Server is shutting down",
+		})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+}
+
+// parseBeaconBody decodes the body like c.BodyParser, but also accepts JSON
+// sent as text/plain (or without a content type), which is what
+// navigator.sendBeacon uses for string payloads.
+func parseBeaconBody(c *fiber.Ctx, out any) error {
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+	if contentType == "" || strings.HasPrefix(contentType, fiber.MIMETextPlain) {
+		return json.Unmarshal(c.Body(), out)
+	}
+
+	return c.BodyParser(out)
+}
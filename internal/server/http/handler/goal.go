@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ramisoul84/emil-server/internal/domain"
+)
+
+type goalService interface {
+	CreateGoal(ctx context.Context, goal *domain.Goal) error
+	GetGoal(ctx context.Context, id int) (*domain.Goal, error)
+	UpdateGoal(ctx context.Context, goal *domain.Goal) error
+	DeleteGoal(ctx context.Context, id int) error
+	ListGoals(ctx context.Context) ([]*domain.Goal, error)
+	Funnel(ctx context.Context, filter *domain.AnalyticsFilter, goalIDs []int) (*domain.FunnelReport, error)
+}
+
+type goalHandler struct {
+	service goalService
+}
+
+func NewGoalHandler(service goalService) *goalHandler {
+	return &goalHandler{
+		service: service,
+	}
+}
+
+func (h *goalHandler) Create(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	var goal domain.Goal
+	if err := c.BodyParser(&goal); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	if err := h.service.CreateGoal(ctx, &goal); err != nil {
+		return goalError(c, err, "Failed to create goal")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(goal)
+}
+
+func (h *goalHandler) Get(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "id must be an integer",
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	goal, err := h.service.GetGoal(ctx, id)
+	if err != nil {
+		return goalError(c, err, "Failed to get goal")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(goal)
+}
+
+func (h *goalHandler) Update(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "id must be an integer",
+		})
+	}
+
+	var goal domain.Goal
+	if err := c.BodyParser(&goal); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	goal.ID = id
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	if err := h.service.UpdateGoal(ctx, &goal); err != nil {
+		return goalError(c, err, "Failed to update goal")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(goal)
+}
+
+func (h *goalHandler) Delete(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "id must be an integer",
+		})
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	if err := h.service.DeleteGoal(ctx, id); err != nil {
+		return goalError(c, err, "Failed to delete goal")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Goal Deleted",
+	})
+}
+
+func (h *goalHandler) List(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	goals, err := h.service.ListGoals(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list goals",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(goals)
+}
+
+// Funnel reports conversion across the goals given as ?steps=1,2,3.
+func (h *goalHandler) Funnel(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+
+	filter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var goalIDs []int
+	for _, step := range strings.Split(c.Query("steps"), ",") {
+		if step == "" {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(step))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "steps must be a comma-separated list of goal IDs",
+			})
+		}
+		goalIDs = append(goalIDs, id)
+	}
+
+	ctx := context.WithValue(c.Context(), "request_id", requestId)
+	report, err := h.service.Funnel(ctx, filter, goalIDs)
+	if err != nil {
+		return goalError(c, err, "Failed to get funnel")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+func goalError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, domain.ErrValidation):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, domain.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Goal not found",
+		})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ramisoul84/emil-server/internal/domain"
+)
+
+// trackerScript is the browser tracker served at /t.js. Its version is in
+// the banner comment, the ETag changes with every change to the script.
+//
+//go:embed tracker/t.js
+var trackerScript []byte
+
+var trackerETag = func() string {
+	sum := sha256.Sum256(trackerScript)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}()
+
+// trackerMaxAge is short as the script URL is not versioned, so fixes reach
+// browsers within the hour. Revalidation is cheap thanks to the ETag.
+const trackerMaxAge = "public, max-age=3600"
+
+// transparentGIF is a 1x1 transparent GIF.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// Script serves the tracker, answering 304 when the browser has the current version.
+func (h *analyticsHandler) Script(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, trackerMaxAge)
+	c.Set(fiber.HeaderETag, trackerETag)
+
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" && strings.Contains(match, trackerETag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/javascript; charset=utf-8")
+	return c.Status(fiber.StatusOK).Send(trackerScript)
+}
+
+// Pixel records a visit for clients without JavaScript and for email opens.
+// The page defaults to the Referer header, which is the page an <img> sits
+// on. utm_* parameters of the pixel URL are added to the page URL. The GIF
+// is returned even when the visit cannot be recorded.
+func (h *analyticsHandler) Pixel(c *fiber.Ctx) error {
+	requestId := c.Locals("request_id").(string)
+	ip := c.Locals("ip").(string)
+
+	data := domain.VisitStartData{
+		SessionID: c.Query("sid"),
+		UserID:    c.Query("uid"),
+		Referrer:  c.Query("ref"),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		URL:       pixelURL(c),
+	}
+	if data.SessionID == "" {
+		data.SessionID = uuid.New().String()
+	}
+
+	ctx := context.WithValue(c.Context(), "ip", ip)
+	ctx = context.WithValue(ctx, "request_id", requestId)
+
+	// Errors are logged by the service, a broken image would not help anyone.
+	_ = h.service.VisitStart(ctx, &data)
+
+	c.Set(fiber.HeaderContentType, "image/gif")
+	c.Set(fiber.HeaderCacheControl, "no-store, no-cache, must-revalidate, max-age=0")
+	c.Set(fiber.HeaderPragma, "no-cache")
+	c.Set(fiber.HeaderExpires, "0")
+
+	return c.Status(fiber.StatusOK).Send(transparentGIF)
+}
+
+// pixelURL returns the tracked page: the url parameter or the Referer header,
+// with the utm_* parameters of the pixel request it does not carry itself.
+func pixelURL(c *fiber.Ctx) string {
+	raw := c.Query("url")
+	if raw == "" {
+		raw = c.Get(fiber.HeaderReferer)
+	}
+
+	page, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	query := page.Query()
+	for key, value := range c.Queries() {
+		if strings.HasPrefix(key, "utm_") && query.Get(key) == "" {
+			query.Set(key, value)
+		}
+	}
+	page.RawQuery = query.Encode()
+
+	return page.String()
+}
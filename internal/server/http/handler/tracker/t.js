@@ -0,0 +1,298 @@
+/*! emil-server tracker v1.2.0 */
+(function () {
+  'use strict';
+
+  var VERSION = '1.2.0';
+  var HEARTBEAT_INTERVAL = 15000;
+  var SESSION_KEY = 'emil_session';
+  var MAX_CLICKS = 200;
+  var DOWNLOAD = /\.(pdf|zip|rar|7z|gz|tar|docx?|xlsx?|pptx?|odt|csv|txt|dmg|exe|apk)$/i;
+
+  var script = document.currentScript;
+  if (!script || window.emil) return;
+
+  var api = script.getAttribute('data-api') || new URL(script.src).origin + '/api/v1';
+  // The session timeout in seconds must match ANALYTICS_SESSION_TIMEOUT of the server.
+  var timeout = (parseInt(script.getAttribute('data-session-timeout'), 10) || 300) * 1000;
+
+  function newId() {
+    if (window.crypto && crypto.randomUUID) return crypto.randomUUID();
+    return Date.now().toString(36) + '-' + Math.random().toString(36).slice(2);
+  }
+
+  // The user ID survives across visits, storage may be blocked though.
+  function userId() {
+    try {
+      var id = localStorage.getItem('emil_uid');
+      if (!id) {
+        id = newId();
+        localStorage.setItem('emil_uid', id);
+      }
+      return id;
+    } catch (e) {
+      return newId();
+    }
+  }
+
+  // Bodies go out as text/plain, which the server accepts as JSON and
+  // browsers send cross-origin without a preflight.
+  function send(path, body, beacon) {
+    var data = JSON.stringify(body);
+    if (beacon && navigator.sendBeacon && navigator.sendBeacon(api + path, data)) {
+      return Promise.resolve(null);
+    }
+    return fetch(api + path, { method: 'POST', body: data, keepalive: true }).catch(function () {
+      return null;
+    });
+  }
+
+  function sendEvent(name, properties, beacon) {
+    return send('/analytics/batch', [{ session_id: state.sessionId, name: name, properties: properties || {} }], beacon);
+  }
+
+  var uid = userId();
+  var visible = document.visibilityState === 'visible';
+  var state;
+
+  function reset(saved) {
+    saved = saved || {};
+    state = {
+      sessionId: saved.id || newId(),
+      startTime: saved.start || new Date().toISOString(),
+      active: saved.active || 0,
+      lastTick: Date.now(),
+      actions: saved.actions || {},
+      actionTimes: saved.actionTimes || {},
+      url: location.href,
+      path: location.pathname,
+      clicks: [],
+      maxScroll: 0
+    };
+  }
+
+  // The session lives in sessionStorage, so reloads and page loads in the
+  // same tab keep reporting to it until the server would have timed it out.
+  function load() {
+    try {
+      var saved = JSON.parse(sessionStorage.getItem(SESSION_KEY));
+      if (saved && saved.id && Date.now() - saved.seen < timeout) return saved;
+    } catch (e) {}
+    return null;
+  }
+
+  function save() {
+    try {
+      sessionStorage.setItem(SESSION_KEY, JSON.stringify({
+        id: state.sessionId,
+        start: state.startTime,
+        active: state.active,
+        actions: state.actions,
+        actionTimes: state.actionTimes,
+        seen: Date.now()
+      }));
+    } catch (e) {}
+  }
+
+  // tick adds the time since the last tick to the active time while the page is visible.
+  function tick() {
+    var now = Date.now();
+    if (visible) state.active += (now - state.lastTick) / 1000;
+    state.lastTick = now;
+  }
+
+  // begin continues the stored session of the tab with a pageview, or
+  // starts a new one.
+  function begin() {
+    var saved = load();
+    if (!saved) return start();
+    reset(saved);
+    save();
+    sendEvent('pageview', { path: location.pathname, title: document.title });
+  }
+
+  function start() {
+    reset();
+    save();
+    var tz = '';
+    try {
+      tz = Intl.DateTimeFormat().resolvedOptions().timeZone || '';
+    } catch (e) {}
+
+    send('/analytics/visit-start', {
+      session_id: state.sessionId,
+      user_id: uid,
+      referrer: document.referrer,
+      user_agent: navigator.userAgent,
+      url: location.href,
+      screen_width: screen.width,
+      screen_height: screen.height,
+      viewport_width: window.innerWidth,
+      viewport_height: window.innerHeight,
+      language: navigator.language || '',
+      timezone: tz
+    });
+    sendEvent('pageview', { path: location.pathname, title: document.title });
+  }
+
+  // actionAges tells how many seconds ago each action was first taken, so the
+  // server can date actions on its own clock.
+  function actionAges() {
+    var now = Date.now();
+    var ages = {};
+    for (var name in state.actionTimes) {
+      ages[name] = (now - state.actionTimes[name]) / 1000;
+    }
+    return ages;
+  }
+
+  function heartbeat(beacon) {
+    tick();
+    save();
+    return send('/analytics/heartbeat', {
+      session_id: state.sessionId,
+      duration: state.active,
+      actions: state.actions,
+      action_ages: actionAges()
+    }, beacon);
+  }
+
+  // flushInteractions reports the clicks and scroll depth of the current page view.
+  function flushInteractions() {
+    var width = window.innerWidth;
+    var pageHeight = Math.max(document.documentElement.scrollHeight, window.innerHeight);
+    var clicks = state.clicks.filter(function (c) {
+      return c.x <= width && c.y <= pageHeight;
+    });
+
+    send('/analytics/interactions', {
+      session_id: state.sessionId,
+      url: state.url,
+      user_agent: navigator.userAgent,
+      viewport_width: width,
+      viewport_height: window.innerHeight,
+      page_height: pageHeight,
+      max_scroll: state.maxScroll,
+      clicks: clicks
+    }, true);
+
+    state.clicks = [];
+    state.maxScroll = Math.round(window.scrollY);
+  }
+
+  // leave reports the page being left. The session stays open, since the
+  // next page of the visit may load in the same tab; the server closes it
+  // once the heartbeats stop.
+  function leave() {
+    flushInteractions();
+    heartbeat(true);
+  }
+
+  // route records SPA navigations made with the History API.
+  function route() {
+    if (location.pathname === state.path) return;
+    flushInteractions();
+    state.url = location.href;
+    state.path = location.pathname;
+    sendEvent('pageview', { path: location.pathname, title: document.title });
+  }
+
+  function selector(el) {
+    var parts = [];
+    while (el && el.nodeType === 1 && parts.length < 4) {
+      var part = el.tagName.toLowerCase();
+      if (el.id) {
+        parts.unshift(part + '#' + el.id);
+        break;
+      }
+      if (typeof el.className === 'string' && el.className.trim()) {
+        part += '.' + el.className.trim().split(/\s+/).slice(0, 2).join('.');
+      }
+      parts.unshift(part);
+      el = el.parentElement;
+    }
+    return parts.join(' > ');
+  }
+
+  function trackLink(a) {
+    var url;
+    try {
+      url = new URL(a.href, location.href);
+    } catch (e) {
+      return;
+    }
+    if (url.protocol !== 'http:' && url.protocol !== 'https:') return;
+
+    var name = a.hasAttribute('download') || DOWNLOAD.test(url.pathname) ? 'download' : 'outbound';
+    if (name === 'outbound' && url.host === location.host) return;
+
+    sendEvent(name, { url: url.href, path: location.pathname }, true);
+  }
+
+  function onClick(e) {
+    var target = e.target;
+    if (!target || !target.closest) return;
+
+    var action = target.closest('[data-action]');
+    if (action) {
+      var name = action.getAttribute('data-action');
+      state.actions[name] = (state.actions[name] || 0) + 1;
+      if (!state.actionTimes[name]) state.actionTimes[name] = Date.now();
+      save();
+    }
+
+    var link = target.closest('a[href]');
+    if (link) trackLink(link);
+
+    if (state.clicks.length < MAX_CLICKS) {
+      state.clicks.push({
+        x: Math.round(e.clientX),
+        y: Math.round(e.pageY),
+        selector: selector(target)
+      });
+    }
+  }
+
+  ['pushState', 'replaceState'].forEach(function (method) {
+    var original = history[method];
+    history[method] = function () {
+      var result = original.apply(this, arguments);
+      route();
+      return result;
+    };
+  });
+  window.addEventListener('popstate', route);
+
+  document.addEventListener('click', onClick, true);
+  window.addEventListener('scroll', function () {
+    state.maxScroll = Math.max(state.maxScroll, Math.round(window.scrollY));
+  }, { passive: true });
+
+  document.addEventListener('visibilitychange', function () {
+    tick();
+    visible = document.visibilityState === 'visible';
+    if (!visible) heartbeat(true);
+  });
+  window.addEventListener('pagehide', leave);
+  // A page restored from the back/forward cache picks up the session of the
+  // tab, which other pages may have moved on since it was hidden.
+  window.addEventListener('pageshow', function (e) {
+    if (e.persisted) begin();
+  });
+
+  setInterval(function () {
+    if (!visible) return;
+    heartbeat(false).then(function (res) {
+      // The server closed the session after a long pause, start over.
+      if (res && res.status === 404) start();
+    });
+  }, HEARTBEAT_INTERVAL);
+
+  window.emil = {
+    version: VERSION,
+    track: function (name, properties) {
+      return sendEvent(name, properties);
+    }
+  };
+
+  begin();
+})();
@@ -7,7 +7,6 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/ramisoul84/emil-server/pkg/location"
 	"github.com/ramisoul84/emil-server/pkg/logger"
 )
 
@@ -45,7 +44,19 @@ func init() {
 	)
 }
 
-func ObservabilityMiddleware(logger logger.Logger) fiber.Handler {
+// clientIPResolver finds the client address behind trusted proxies.
+type clientIPResolver interface {
+	ClientIP(c *fiber.Ctx) string
+}
+
+// ipAnonymizer turns a client IP into the value that may be logged.
+type ipAnonymizer interface {
+	Anonymize(ip string) string
+}
+
+// ObservabilityMiddleware resolves the client IP for the handlers and logs
+// and measures each request. Logs only get the anonymized IP.
+func ObservabilityMiddleware(logger logger.Logger, resolver clientIPResolver, anonymizer ipAnonymizer) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		httpRequestsInFlight.Inc()
 		defer httpRequestsInFlight.Dec()
@@ -53,18 +64,17 @@ func ObservabilityMiddleware(logger logger.Logger) fiber.Handler {
 		start := time.Now()
 
 		requestId := generateRequestID()
+		ip := resolver.ClientIP(c)
 
 		reqLogger := logger.WithFields(
 			map[string]any{
 				"request_id": requestId,
 				"method":     c.Method(),
 				"path":       c.Path(),
-				"ip":         c.IP(),
+				"ip":         anonymizer.Anonymize(ip),
 			},
 		)
 
-		ip := location.GetRealClientIP(c)
-
 		c.Locals("request_id", requestId)
 		c.Locals("ip", ip)
 
@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,14 +13,36 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/ramisoul84/emil-server/config"
 	"github.com/ramisoul84/emil-server/internal/server/http/middleware"
+	"github.com/ramisoul84/emil-server/pkg/location"
 	"github.com/ramisoul84/emil-server/pkg/logger"
 )
 
 type analyticsHandler interface {
 	VisitStart(c *fiber.Ctx) error
 	VisitEnd(c *fiber.Ctx) error
+	Heartbeat(c *fiber.Ctx) error
+	Script(c *fiber.Ctx) error
+	Pixel(c *fiber.Ctx) error
+	Live(c *fiber.Ctx) error
+	Active(c *fiber.Ctx) error
 	List(c *fiber.Ctx) error
 	Stats(c *fiber.Ctx) error
+	Breakdown(c *fiber.Ctx) error
+	Campaigns(c *fiber.Ctx) error
+	Pages(c *fiber.Ctx) error
+	Cohorts(c *fiber.Ctx) error
+	Profile(c *fiber.Ctx) error
+	TrackVitals(c *fiber.Ctx) error
+	Vitals(c *fiber.Ctx) error
+	TrackInteractions(c *fiber.Ctx) error
+	Heatmap(c *fiber.Ctx) error
+	Links(c *fiber.Ctx) error
+	TrackError(c *fiber.Ctx) error
+	Errors(c *fiber.Ctx) error
+	ErrorGroup(c *fiber.Ctx) error
+	TrackEvent(c *fiber.Ctx) error
+	TrackEvents(c *fiber.Ctx) error
+	Events(c *fiber.Ctx) error
 }
 
 type authHandler interface {
@@ -34,16 +57,42 @@ type messageHandler interface {
 	List(c *fiber.Ctx) error
 }
 
+type goalHandler interface {
+	Create(c *fiber.Ctx) error
+	Get(c *fiber.Ctx) error
+	Update(c *fiber.Ctx) error
+	Delete(c *fiber.Ctx) error
+	List(c *fiber.Ctx) error
+	Funnel(c *fiber.Ctx) error
+}
+
+type ingestPipeline interface {
+	Shutdown(ctx context.Context) error
+}
+
+type liveStream interface {
+	Close()
+}
+
+// ipAnonymizer turns a client IP into the value that may be logged.
+type ipAnonymizer interface {
+	Anonymize(ip string) string
+}
+
 type Server struct {
 	app              *fiber.App
+	ingest           ingestPipeline
+	live             liveStream
 	analyticsHandler analyticsHandler
 	authHandler      authHandler
 	messageHandler   messageHandler
+	goalHandler      goalHandler
+	anonymizer       ipAnonymizer
 	cfg              *config.Config
 	logger           logger.Logger
 }
 
-func NewServer(cfg *config.Config, analyticsHandler analyticsHandler, authHandler authHandler, messageHandler messageHandler) *Server {
+func NewServer(cfg *config.Config, ingest ingestPipeline, live liveStream, analyticsHandler analyticsHandler, authHandler authHandler, messageHandler messageHandler, goalHandler goalHandler, anonymizer ipAnonymizer) *Server {
 	app := fiber.New(fiber.Config{
 		ReadTimeout:           cfg.Server.ReadTimeout,
 		WriteTimeout:          cfg.Server.WriteTimeout,
@@ -53,9 +102,13 @@ func NewServer(cfg *config.Config, analyticsHandler analyticsHandler, authHandle
 
 	srv := &Server{
 		app:              app,
+		ingest:           ingest,
+		live:             live,
 		analyticsHandler: analyticsHandler,
 		authHandler:      authHandler,
 		messageHandler:   messageHandler,
+		goalHandler:      goalHandler,
+		anonymizer:       anonymizer,
 		logger:           logger.Get(),
 		cfg:              cfg,
 	}
@@ -69,7 +122,7 @@ func NewServer(cfg *config.Config, analyticsHandler analyticsHandler, authHandle
 func (s *Server) setupMiddlewares() {
 	s.app.Use(requestid.New())
 	s.app.Use(middleware.CORSMiddleware(s.cfg))
-	s.app.Use(middleware.ObservabilityMiddleware(s.logger))
+	s.app.Use(middleware.ObservabilityMiddleware(s.logger, location.NewClientIPResolver(s.cfg), s.anonymizer))
 
 	s.app.Use(recover.New())
 }
@@ -84,10 +137,19 @@ func (s *Server) setupRoutes() {
 		})
 	})
 
+	s.app.Get("/t.js", s.analyticsHandler.Script)
+	s.app.Get("/p.gif", s.analyticsHandler.Pixel)
+
 	api := s.app.Group("/api/v1")
 	public := api.Group("/")
 	public.Post("/analytics/visit-start", s.analyticsHandler.VisitStart)
 	public.Post("/analytics/visit-end", s.analyticsHandler.VisitEnd)
+	public.Post("/analytics/heartbeat", s.analyticsHandler.Heartbeat)
+	public.Post("/analytics/event", s.analyticsHandler.TrackEvent)
+	public.Post("/analytics/batch", s.analyticsHandler.TrackEvents)
+	public.Post("/analytics/vitals", s.analyticsHandler.TrackVitals)
+	public.Post("/analytics/interactions", s.analyticsHandler.TrackInteractions)
+	public.Post("/analytics/error", s.analyticsHandler.TrackError)
 	public.Post("/auth/login", s.authHandler.Login)
 	public.Post("/message/save", s.messageHandler.Create)
 
@@ -95,6 +157,25 @@ func (s *Server) setupRoutes() {
 	protected.Use(middleware.AuthMiddleware(s.cfg, s.logger))
 	protected.Get("/analytics/list", s.analyticsHandler.List)
 	protected.Get("/analytics/stats", s.analyticsHandler.Stats)
+	protected.Get("/analytics/breakdown", s.analyticsHandler.Breakdown)
+	protected.Get("/analytics/campaigns", s.analyticsHandler.Campaigns)
+	protected.Get("/analytics/pages", s.analyticsHandler.Pages)
+	protected.Get("/analytics/cohorts", s.analyticsHandler.Cohorts)
+	protected.Get("/analytics/users/:user_id", s.analyticsHandler.Profile)
+	protected.Get("/analytics/events", s.analyticsHandler.Events)
+	protected.Get("/analytics/vitals", s.analyticsHandler.Vitals)
+	protected.Get("/analytics/heatmap", s.analyticsHandler.Heatmap)
+	protected.Get("/analytics/links", s.analyticsHandler.Links)
+	protected.Get("/analytics/errors", s.analyticsHandler.Errors)
+	protected.Get("/analytics/errors/:id", s.analyticsHandler.ErrorGroup)
+	protected.Get("/analytics/live", s.analyticsHandler.Live)
+	protected.Get("/analytics/live/active", s.analyticsHandler.Active)
+	protected.Get("/analytics/goals", s.goalHandler.List)
+	protected.Post("/analytics/goals", s.goalHandler.Create)
+	protected.Get("/analytics/goals/:id", s.goalHandler.Get)
+	protected.Put("/analytics/goals/:id", s.goalHandler.Update)
+	protected.Delete("/analytics/goals/:id", s.goalHandler.Delete)
+	protected.Get("/analytics/funnel", s.goalHandler.Funnel)
 	protected.Get("/message/{:id}", s.messageHandler.Get)
 	protected.Patch("/message/{:id}", s.messageHandler.Update)
 	protected.Delete("/message/{:id}", s.messageHandler.Delete)
@@ -116,5 +197,11 @@ func (s *Server) Shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.ShutdownTimeout)
 	defer cancel()
 
-	return s.app.ShutdownWithContext(ctx)
+	// End live streams so they don't hold the shutdown, stop accepting
+	// requests, then drain what was already queued.
+	s.live.Close()
+	appErr := s.app.ShutdownWithContext(ctx)
+	ingestErr := s.ingest.Shutdown(ctx)
+
+	return errors.Join(appErr, ingestErr)
 }
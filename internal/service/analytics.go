@@ -2,40 +2,110 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/mssola/useragent"
+	"github.com/ramisoul84/emil-server/config"
 	"github.com/ramisoul84/emil-server/internal/domain"
 	"github.com/ramisoul84/emil-server/pkg/location"
 	"github.com/ramisoul84/emil-server/pkg/logger"
 )
 
 type analyticsRepository interface {
-	SaveVisit(ctx context.Context, data *domain.Data) error
+	StartSession(ctx context.Context, data *domain.Data) error
+	TouchSession(ctx context.Context, sessionID string, activeDuration float64, actions map[string]int, firstSeen map[string]time.Time, actionsCount int, at time.Time) (bool, error)
+	EndSession(ctx context.Context, data *domain.Data, endTime time.Time) error
+	FinalizeStaleSessions(ctx context.Context, cutoff time.Time) (int64, error)
+	CountActiveSessions(ctx context.Context, since time.Time) (int, error)
 	ListVisits(ctx context.Context, limit, offset int) ([]*domain.Data, error)
-	GetVisitsStats(ctx context.Context) (*domain.Stats, error)
+	GetVisitsStats(ctx context.Context, filter *domain.AnalyticsFilter) (*domain.Stats, error)
+	GetStatsSeries(ctx context.Context, filter *domain.AnalyticsFilter) ([]domain.StatsBucket, error)
+	GetBreakdown(ctx context.Context, filter *domain.AnalyticsFilter, dimension string, limit int) ([]*domain.BreakdownItem, error)
+	GetCampaigns(ctx context.Context, filter *domain.AnalyticsFilter) ([]*domain.CampaignItem, error)
+	GetTopPages(ctx context.Context, filter *domain.AnalyticsFilter, limit int) ([]*domain.PageItem, error)
+	GetCohorts(ctx context.Context, filter *domain.AnalyticsFilter, weeks int) ([]domain.CohortCell, error)
+	ListUserVisits(ctx context.Context, userID string) ([]*domain.Data, error)
+	GetUserActions(ctx context.Context, userID string) ([]*domain.ActionCount, error)
+	SaveEvents(ctx context.Context, events []*domain.Event) error
+	GetLinks(ctx context.Context, filter *domain.AnalyticsFilter, limit int) (*domain.LinksReport, error)
+	SaveVitals(ctx context.Context, samples []*domain.VitalSample) error
+	SaveInteractions(ctx context.Context, clicks []*domain.ClickSample, scroll *domain.ScrollSample) error
+	GetHeatmap(ctx context.Context, filter *domain.HeatmapFilter, selectors int) ([]*domain.HeatmapPage, error)
+	SaveClientError(ctx context.Context, group *domain.ErrorGroup, occurrence *domain.ErrorOccurrence) (bool, error)
+	ListErrorGroups(ctx context.Context, filter *domain.AnalyticsFilter, limit, offset int) ([]*domain.ErrorGroup, error)
+	GetErrorGroup(ctx context.Context, id int64, occurrences int) (*domain.ErrorGroupDetail, error)
+	GetVitals(ctx context.Context, filter *domain.VitalsFilter) ([]*domain.VitalsItem, []*domain.VitalsItem, error)
+	ListEvents(ctx context.Context, filter *domain.EventFilter) ([]*domain.Event, error)
+}
+
+// messageReader gives the analytics service access to contact messages.
+type messageReader interface {
+	ListByUser(ctx context.Context, userID string) ([]*domain.Message, error)
 }
 
 type botNotifier interface {
 	Notify(ctx context.Context, msg string) error
 }
 
+type ingestQueue interface {
+	Submit(ctx context.Context, name string, run func(ctx context.Context) error) error
+}
+
+// locator resolves the location and network of client IPs.
+type locator interface {
+	Lookup(ctx context.Context, ip string) location.GeoInfo
+}
+
+// ipAnonymizer turns a client IP into the value that may be persisted.
+type ipAnonymizer interface {
+	Anonymize(ip string) string
+}
+
+type liveBroadcaster interface {
+	Publish(event domain.LiveEvent)
+	Subscribe() (<-chan domain.LiveEvent, func())
+}
+
 type analyticsService struct {
-	repo   analyticsRepository
-	bot    botNotifier
-	logger logger.Logger
+	repo            analyticsRepository
+	messages        messageReader
+	bot             botNotifier
+	ingest          ingestQueue
+	live            liveBroadcaster
+	locator         locator
+	anonymizer      ipAnonymizer
+	errorAlerts     *alertThrottle
+	sessionTimeout  time.Duration
+	sweepInterval   time.Duration
+	activeWindow    time.Duration
+	bounceThreshold time.Duration
+	logger          logger.Logger
 }
 
-func NewAnalyticsService(repo analyticsRepository, bot botNotifier) *analyticsService {
+func NewAnalyticsService(cfg *config.Config, repo analyticsRepository, messages messageReader, bot botNotifier, ingest ingestQueue, live liveBroadcaster, locator locator, anonymizer ipAnonymizer) *analyticsService {
 	return &analyticsService{
-		repo:   repo,
-		bot:    bot,
-		logger: logger.Get(),
+		repo:            repo,
+		messages:        messages,
+		bot:             bot,
+		ingest:          ingest,
+		live:            live,
+		locator:         locator,
+		anonymizer:      anonymizer,
+		errorAlerts:     newAlertThrottle(maxErrorAlerts, errorAlertWindow),
+		sessionTimeout:  cfg.Analytics.SessionTimeout,
+		sweepInterval:   cfg.Analytics.SessionSweepInterval,
+		activeWindow:    cfg.Analytics.ActiveWindow,
+		bounceThreshold: cfg.Analytics.BounceThreshold,
+		logger:          logger.Get(),
 	}
 }
 
+// VisitStart queues the visit for enrichment and notification.
 func (s *analyticsService) VisitStart(ctx context.Context, data *domain.VisitStartData) error {
 	logger := s.logger.WithFields(
 		map[string]any{
@@ -47,9 +117,61 @@ func (s *analyticsService) VisitStart(ctx context.Context, data *domain.VisitSta
 
 	logger.Info().Msg("➡️  [Service] Handling visit")
 
-	ip := ctx.Value("ip").(string)
-	country, city := location.GetFullClientInfo(ip)
+	startTime := time.Now()
+
+	err := s.ingest.Submit(ctx, "visit_start", func(ctx context.Context) error {
+		return s.processVisitStart(ctx, data, startTime)
+	})
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to queue visit")
+		return err
+	}
+
+	return nil
+}
+
+func (s *analyticsService) processVisitStart(ctx context.Context, data *domain.VisitStartData, startTime time.Time) error {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "process_visit_start",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	// Geolocation needs the full address, only the anonymized one is kept.
+	geo := s.locator.Lookup(ctx, ctx.Value("ip").(string))
+	ip := s.anonymizer.Anonymize(ctx.Value("ip").(string))
+	country, city := geo.Country, geo.City
 	os := getOS(data.UserAgent)
+	attribution := attribute(data.Referrer, data.URL)
+
+	visit := domain.Data{
+		SessionID:   data.SessionID,
+		UserID:      data.UserID,
+		IP:          ip,
+		Country:     country,
+		City:        city,
+		OS:          os,
+		Browser:     getBrowser(data.UserAgent),
+		StartTime:   startTime.UTC().Format(time.RFC3339Nano),
+		LandingPage: truncate(getPath(data.URL), maxPathLength),
+		Attribution: attribution,
+		Device:      withClientDevice(getDevice(data.UserAgent), data),
+		GeoInfo:     storedGeo(geo),
+	}
+	classifyVisit(&visit, data.UserAgent, geo.ASN, false)
+
+	if err := s.repo.StartSession(ctx, &visit); err != nil {
+		logger.Error().Err(err).Msg("Failed to save session start")
+		return err
+	}
+
+	if visit.IsBot {
+		logger.Info().Str("reason", visit.BotReason).Msg("Visit classified as bot")
+		botVisitsTotal.WithLabelValues(visit.BotReason).Inc()
+		return nil
+	}
 
 	msg := fmt.Sprintf(
 		"👁 *New Site Visitor*\n\n"+
@@ -59,7 +181,8 @@ func (s *analyticsService) VisitStart(ctx context.Context, data *domain.VisitSta
 			"👤 *SESSION:* %s\n"+
 			"👤 *User:* %s\n"+
 			"📱 *Device OS:* %s\n"+
-			"🔗 *Referrer:* %s\n",
+			"🔗 *Referrer:* %s\n"+
+			"📣 *Channel:* %s\n",
 		ip,
 		country,
 		city,
@@ -67,15 +190,138 @@ func (s *analyticsService) VisitStart(ctx context.Context, data *domain.VisitSta
 		data.UserID,
 		os,
 		data.Referrer,
+		channelSummary(attribution),
 	)
 
 	if err := s.bot.Notify(context.Background(), msg); err != nil {
 		logger.Error().Err(err).Msg("Failed to send bot notification")
 	}
 
+	s.live.Publish(domain.LiveEvent{
+		Type:      domain.LiveVisitStart,
+		SessionID: data.SessionID,
+		UserID:    data.UserID,
+		Country:   country,
+		City:      city,
+		OS:        os,
+		Referrer:  data.Referrer,
+		Time:      startTime.UTC(),
+	})
+
 	return nil
 }
 
+// Heartbeat keeps a session alive and records its progress so far.
+func (s *analyticsService) Heartbeat(ctx context.Context, data *domain.HeartbeatData) error {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "heartbeat",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Debug().Msg("➡️  [Service] Handling heartbeat")
+
+	if data.SessionID == "" {
+		return fmt.Errorf("%w: session_id is required", domain.ErrValidation)
+	}
+
+	now := time.Now().UTC()
+	actionsCount := getActionsCount(data.Actions)
+
+	actions := storedActions(data.Actions)
+	firstSeen := actionsFirstSeen(actions, data.ActionAges, now)
+
+	isBot, err := s.repo.TouchSession(ctx, data.SessionID, data.Duration, actions, firstSeen, actionsCount, now)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+		logger.Error().Err(err).Msg("Failed to record heartbeat")
+		return domain.ErrInternal
+	}
+
+	// Bots are kept off the live stream like their visit-start.
+	if isBot {
+		return nil
+	}
+
+	s.live.Publish(domain.LiveEvent{
+		Type:           domain.LiveHeartbeat,
+		SessionID:      data.SessionID,
+		ActiveDuration: data.Duration,
+		ActionsCount:   actionsCount,
+		Time:           now,
+	})
+
+	return nil
+}
+
+// SubscribeLive streams visit-start, heartbeat and visit-end events as they happen.
+func (s *analyticsService) SubscribeLive() (<-chan domain.LiveEvent, func()) {
+	return s.live.Subscribe()
+}
+
+// ActiveVisitors counts open sessions with a heartbeat within the active window.
+func (s *analyticsService) ActiveVisitors(ctx context.Context) (int, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "active_visitors",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	since := time.Now().UTC().Add(-s.activeWindow)
+	count, err := s.repo.CountActiveSessions(ctx, since)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to count active visitors")
+		return 0, domain.ErrInternal
+	}
+
+	return count, nil
+}
+
+// RunSessionSweeper periodically finalizes sessions that stopped sending
+// heartbeats, until ctx is cancelled.
+func (s *analyticsService) RunSessionSweeper(ctx context.Context) {
+	ctx = context.WithValue(ctx, "request_id", "session_sweeper")
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":  "analytics_service",
+			"method": "session_sweeper",
+		},
+	)
+
+	logger.Info().
+		Dur("interval", s.sweepInterval).
+		Dur("timeout", s.sessionTimeout).
+		Msg("Session sweeper started")
+
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info().Msg("Session sweeper stopped")
+			return
+		case <-ticker.C:
+			cutoff := time.Now().UTC().Add(-s.sessionTimeout)
+			finalized, err := s.repo.FinalizeStaleSessions(ctx, cutoff)
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to finalize stale sessions")
+				continue
+			}
+			if finalized > 0 {
+				logger.Info().Int64("count", finalized).Msg("Finalized stale sessions")
+			}
+		}
+	}
+}
+
+// VisitEnd queues the finished visit for enrichment, notification and storage.
 func (s *analyticsService) VisitEnd(ctx context.Context, visitData *domain.VisitData) error {
 	logger := s.logger.WithFields(
 		map[string]any{
@@ -87,18 +333,42 @@ func (s *analyticsService) VisitEnd(ctx context.Context, visitData *domain.Visit
 
 	logger.Info().Msg("➡️  [Service] Handling visit end")
 
-	ip := ctx.Value("ip").(string)
-	country, city := location.GetFullClientInfo(ip)
+	// The visit ends now, not when a worker picks it up.
+	endTime := time.Now()
+
+	err := s.ingest.Submit(ctx, "visit_end", func(ctx context.Context) error {
+		return s.processVisitEnd(ctx, visitData, endTime)
+	})
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to queue visit end")
+		return err
+	}
+
+	return nil
+}
+
+func (s *analyticsService) processVisitEnd(ctx context.Context, visitData *domain.VisitData, endTime time.Time) error {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "process_visit_end",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	geo := s.locator.Lookup(ctx, ctx.Value("ip").(string))
+	ip := s.anonymizer.Anonymize(ctx.Value("ip").(string))
+	country, city := geo.Country, geo.City
 	os := getOS(visitData.UserAgent)
 
 	tt, err := time.Parse(time.RFC3339, visitData.StartTime)
 	var duration time.Duration
 	if err != nil {
 		logger.Error().Err(err).Msgf("Failed to parse start time: %s", visitData.StartTime)
-		duration = time.Duration(visitData.Duration)
+		duration = time.Duration(visitData.Duration * float64(time.Second))
 
 	} else {
-		duration = time.Since(tt)
+		duration = endTime.Sub(tt)
 	}
 
 	var data domain.Data
@@ -108,10 +378,31 @@ func (s *analyticsService) VisitEnd(ctx context.Context, visitData *domain.Visit
 	data.Country = country
 	data.City = city
 	data.OS = os
+	data.Browser = getBrowser(visitData.UserAgent)
+	data.Attribution = attribute(visitData.Referrer, visitData.URL)
+	data.Device = getDevice(visitData.UserAgent)
+	data.GeoInfo = storedGeo(geo)
 	data.StartTime = visitData.StartTime
 	data.Duration = duration.Seconds()
 	data.ActiveDuration = visitData.Duration
 	data.ActionsCount = getActionsCount(visitData.Actions)
+	data.Actions = storedActions(visitData.Actions)
+	data.ActionsFirstSeen = actionsFirstSeen(data.Actions, visitData.ActionAges, endTime.UTC())
+	classifyVisit(&data, visitData.UserAgent, geo.ASN, true)
+
+	if err := s.repo.EndSession(ctx, &data, endTime.UTC()); err != nil {
+		logger.Error().Err(err).Msg("Failed to save visit")
+		return err
+	}
+
+	if data.IsBot {
+		logger.Info().Str("reason", data.BotReason).Msg("Visit classified as bot")
+		// User-agent and network classification was counted at visit start.
+		if data.BotReason == domain.BotReasonZeroDuration || data.BotReason == domain.BotReasonActionRate {
+			botVisitsTotal.WithLabelValues(data.BotReason).Inc()
+		}
+		return nil
+	}
 
 	msg := fmt.Sprintf(
 		"📊 *Session Summary*\n\n"+
@@ -141,10 +432,19 @@ func (s *analyticsService) VisitEnd(ctx context.Context, visitData *domain.Visit
 		logger.Error().Err(err).Msg("Failed to send bot notification")
 	}
 
-	if err := s.repo.SaveVisit(ctx, &data); err != nil {
-		logger.Error().Err(err).Msg("Failed to save visit")
-		return domain.ErrInternal
-	}
+	s.live.Publish(domain.LiveEvent{
+		Type:           domain.LiveVisitEnd,
+		SessionID:      data.SessionID,
+		UserID:         data.UserID,
+		Country:        country,
+		City:           city,
+		OS:             os,
+		Referrer:       visitData.Referrer,
+		Duration:       data.Duration,
+		ActiveDuration: data.ActiveDuration,
+		ActionsCount:   data.ActionsCount,
+		Time:           endTime.UTC(),
+	})
 
 	return nil
 }
@@ -169,7 +469,9 @@ func (s *analyticsService) ListVisits(ctx context.Context, limit, offset int) ([
 	return visits, nil
 }
 
-func (s *analyticsService) VisitStats(ctx context.Context) (*domain.Stats, error) {
+// VisitStats returns stats for the filter range, broken down into interval
+// buckets, compared against the previous period of the same length.
+func (s *analyticsService) VisitStats(ctx context.Context, filter *domain.AnalyticsFilter) (*domain.StatsReport, error) {
 	logger := s.logger.WithFields(
 		map[string]any{
 			"layer":      "analytics_service",
@@ -180,19 +482,562 @@ func (s *analyticsService) VisitStats(ctx context.Context) (*domain.Stats, error
 
 	logger.Info().Msg("➡️  [Service] Handling visit stats")
 
-	stats, err := s.repo.GetVisitsStats(ctx)
+	if err := validateSeriesFilter(filter); err != nil {
+		logger.Warn().Err(err).Msg("Invalid stats filter")
+		return nil, err
+	}
+	filter.BounceThreshold = s.bounceThreshold.Seconds()
+
+	stats, err := s.repo.GetVisitsStats(ctx, filter)
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to  get stats")
 		return nil, domain.ErrInternal
 	}
 
-	return stats, nil
+	previousFilter := *filter
+	previousFilter.From = filter.From.Add(-filter.To.Sub(filter.From))
+	previousFilter.To = filter.From
+	previous, err := s.repo.GetVisitsStats(ctx, &previousFilter)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get previous period stats")
+		return nil, domain.ErrInternal
+	}
+
+	series, err := s.repo.GetStatsSeries(ctx, filter)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get stats series")
+		return nil, domain.ErrInternal
+	}
+
+	loc, _ := time.LoadLocation(filter.Timezone)
+	for i := range series {
+		series[i].Time = series[i].Time.In(loc)
+	}
+
+	return &domain.StatsReport{
+		From:     filter.From.In(loc),
+		To:       filter.To.In(loc),
+		Interval: filter.Interval,
+		Timezone: filter.Timezone,
+		Summary:  *stats,
+		Previous: *previous,
+		Change:   compareStats(stats, previous),
+		Series:   series,
+	}, nil
+}
+
+// Breakdown returns the top values of a dimension with visit counts, unique
+// users and average durations.
+func (s *analyticsService) Breakdown(ctx context.Context, filter *domain.AnalyticsFilter, dimension string, limit int) ([]*domain.BreakdownItem, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "breakdown",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Str("dimension", dimension).Msg("➡️  [Service] Handling breakdown")
+
+	if err := validateFilter(filter); err != nil {
+		logger.Warn().Err(err).Msg("Invalid breakdown filter")
+		return nil, err
+	}
+
+	if !slices.Contains(domain.BreakdownDimensions, dimension) {
+		return nil, fmt.Errorf("%w: dimension must be one of %s", domain.ErrValidation, strings.Join(domain.BreakdownDimensions, ", "))
+	}
+
+	items, err := s.repo.GetBreakdown(ctx, filter, dimension, limit)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get breakdown")
+		return nil, domain.ErrInternal
+	}
+
+	return items, nil
+}
+
+// Campaigns reports visits per utm_source, utm_medium and utm_campaign.
+func (s *analyticsService) Campaigns(ctx context.Context, filter *domain.AnalyticsFilter) ([]*domain.CampaignItem, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "campaigns",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling campaigns report")
+
+	if err := validateFilter(filter); err != nil {
+		logger.Warn().Err(err).Msg("Invalid campaigns filter")
+		return nil, err
+	}
+
+	campaigns, err := s.repo.GetCampaigns(ctx, filter)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get campaigns")
+		return nil, domain.ErrInternal
+	}
+
+	return campaigns, nil
+}
+
+// TopPages reports views, unique visitors, time on page and exit rate per path.
+func (s *analyticsService) TopPages(ctx context.Context, filter *domain.AnalyticsFilter, limit int) ([]*domain.PageItem, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "top_pages",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling top pages")
+
+	if err := validateFilter(filter); err != nil {
+		logger.Warn().Err(err).Msg("Invalid top pages filter")
+		return nil, err
+	}
+
+	pages, err := s.repo.GetTopPages(ctx, filter, limit)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get top pages")
+		return nil, domain.ErrInternal
+	}
+
+	return pages, nil
+}
+
+// Cohorts reports weekly retention of the users first seen in the filter
+// range, for up to weeks weeks after their first visit.
+func (s *analyticsService) Cohorts(ctx context.Context, filter *domain.AnalyticsFilter, weeks int) (*domain.CohortReport, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "cohorts",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Int("weeks", weeks).Msg("➡️  [Service] Handling cohorts")
+
+	if err := validateFilter(filter); err != nil {
+		logger.Warn().Err(err).Msg("Invalid cohorts filter")
+		return nil, err
+	}
+
+	cells, err := s.repo.GetCohorts(ctx, filter, weeks)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get cohorts")
+		return nil, domain.ErrInternal
+	}
+
+	loc, _ := time.LoadLocation(filter.Timezone)
+	now := time.Now()
+	report := &domain.CohortReport{
+		From:     filter.From.In(loc),
+		To:       filter.To.In(loc),
+		Timezone: filter.Timezone,
+		Weeks:    weeks,
+		Cohorts:  []*domain.Cohort{},
+	}
+
+	var cohort *domain.Cohort
+	for _, cell := range cells {
+		if cohort == nil || !cohort.Week.Equal(cell.Cohort) {
+			cohort = &domain.Cohort{
+				Week:      cell.Cohort.In(loc),
+				Retention: make([]*float64, weeks+1),
+			}
+			for week := range cohort.Retention {
+				if cohort.Week.AddDate(0, 0, 7*week).Before(now) {
+					cohort.Retention[week] = new(float64)
+				}
+			}
+			report.Cohorts = append(report.Cohorts, cohort)
+		}
+
+		if cell.Week == 0 {
+			cohort.Users = cell.Users
+		}
+		if cohort.Retention[cell.Week] != nil && cohort.Users > 0 {
+			*cohort.Retention[cell.Week] = float64(cell.Users) / float64(cohort.Users)
+		}
+	}
+
+	return report, nil
+}
+
+// maxProfileEvents caps the events returned in a visitor profile.
+const maxProfileEvents = 1000
+
+// VisitorProfile collects the visits, locations, devices, actions, events
+// and contact messages of one user_id.
+func (s *analyticsService) VisitorProfile(ctx context.Context, userID string) (*domain.VisitorProfile, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "visitor_profile",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling visitor profile")
+
+	visits, err := s.repo.ListUserVisits(ctx, userID)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get user visits")
+		return nil, domain.ErrInternal
+	}
+
+	messages, err := s.messages.ListByUser(ctx, userID)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get user messages")
+		return nil, domain.ErrInternal
+	}
+
+	if len(visits) == 0 && len(messages) == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	actions, err := s.repo.GetUserActions(ctx, userID)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get user actions")
+		return nil, domain.ErrInternal
+	}
+
+	events, err := s.repo.ListEvents(ctx, &domain.EventFilter{UserID: userID, Limit: maxProfileEvents})
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get user events")
+		return nil, domain.ErrInternal
+	}
+
+	profile := &domain.VisitorProfile{
+		UserID:    userID,
+		Visits:    visits,
+		Locations: []*domain.ProfileLocation{},
+		Devices:   []*domain.ProfileDevice{},
+		Actions:   actions,
+		Events:    events,
+		Messages:  messages,
+	}
+
+	// Locations and devices are listed in the order they were first seen.
+	locations := map[domain.ProfileLocation]*domain.ProfileLocation{}
+	devices := map[domain.ProfileDevice]*domain.ProfileDevice{}
+	for _, visit := range visits {
+		locationKey := domain.ProfileLocation{Country: visit.Country, City: visit.City}
+		if place, ok := locations[locationKey]; ok {
+			place.Visits++
+		} else {
+			place := &domain.ProfileLocation{Country: visit.Country, City: visit.City, Visits: 1}
+			locations[locationKey] = place
+			profile.Locations = append(profile.Locations, place)
+		}
+
+		deviceKey := domain.ProfileDevice{OS: visit.OS, Browser: visit.Browser, DeviceType: visit.DeviceType}
+		if device, ok := devices[deviceKey]; ok {
+			device.Visits++
+		} else {
+			device := &domain.ProfileDevice{OS: visit.OS, Browser: visit.Browser, DeviceType: visit.DeviceType, Visits: 1}
+			devices[deviceKey] = device
+			profile.Devices = append(profile.Devices, device)
+		}
+	}
+
+	return profile, nil
+}
+
+func (s *analyticsService) TrackEvent(ctx context.Context, event *domain.Event) error {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "track_event",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling event")
+
+	if err := validateEvent(event); err != nil {
+		logger.Warn().Err(err).Msg("Invalid event")
+		return err
+	}
+
+	if err := s.repo.SaveEvents(ctx, []*domain.Event{event}); err != nil {
+		logger.Error().Err(err).Msg("Failed to save event")
+		return domain.ErrInternal
+	}
+
+	return nil
+}
+
+// TrackEvents validates every event of a batch on its own and stores the valid ones.
+// Invalid events are reported in the result instead of failing the whole batch.
+// A nil entry stands for an event the caller could not decode.
+func (s *analyticsService) TrackEvents(ctx context.Context, events []*domain.Event) (*domain.BatchResult, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "track_events",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Int("count", len(events)).Msg("➡️  [Service] Handling events batch")
+
+	result := &domain.BatchResult{}
+	valid := make([]*domain.Event, 0, len(events))
+	for i, event := range events {
+		if event == nil {
+			result.Errors = append(result.Errors, domain.BatchError{Index: i, Error: "invalid event format"})
+			continue
+		}
+		if err := validateEvent(event); err != nil {
+			result.Errors = append(result.Errors, domain.BatchError{Index: i, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, event)
+	}
+	result.Rejected = len(result.Errors)
+
+	if len(result.Errors) > 0 {
+		logger.Warn().Int("rejected", result.Rejected).Msg("Some events in batch are invalid")
+	}
+
+	if len(valid) > 0 {
+		if err := s.repo.SaveEvents(ctx, valid); err != nil {
+			logger.Error().Err(err).Msg("Failed to save events batch")
+			return nil, domain.ErrInternal
+		}
+	}
+	result.Accepted = len(valid)
+
+	return result, nil
+}
+
+// Links reports the top outbound destinations and downloads, and the
+// downloads of the top files over time.
+func (s *analyticsService) Links(ctx context.Context, filter *domain.AnalyticsFilter, limit int) (*domain.LinksReport, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "links",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling links report")
+
+	if err := validateSeriesFilter(filter); err != nil {
+		logger.Warn().Err(err).Msg("Invalid links filter")
+		return nil, err
+	}
+	if len(filter.Filters) > 0 {
+		return nil, fmt.Errorf("%w: the links report cannot be filtered by dimension", domain.ErrValidation)
+	}
+
+	report, err := s.repo.GetLinks(ctx, filter, limit)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get links")
+		return nil, domain.ErrInternal
+	}
+
+	loc, _ := time.LoadLocation(filter.Timezone)
+	for _, bucket := range report.DownloadSeries {
+		bucket.Time = bucket.Time.In(loc)
+	}
+
+	report.From = filter.From.In(loc)
+	report.To = filter.To.In(loc)
+	report.Interval = filter.Interval
+	report.Timezone = filter.Timezone
+
+	return report, nil
+}
+
+func (s *analyticsService) ListEvents(ctx context.Context, filter *domain.EventFilter) ([]*domain.Event, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "list_events",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling events list")
+
+	events, err := s.repo.ListEvents(ctx, filter)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list events")
+		return nil, domain.ErrInternal
+	}
+
+	return events, nil
 }
 
 /*
 	HELPER FUNCTIONS
 */
 
+// maxSeriesBuckets caps the number of buckets a stats series may have.
+const maxSeriesBuckets = 1000
+
+var intervalLengths = map[string]time.Duration{
+	domain.IntervalHour:  time.Hour,
+	domain.IntervalDay:   24 * time.Hour,
+	domain.IntervalWeek:  7 * 24 * time.Hour,
+	domain.IntervalMonth: 30 * 24 * time.Hour,
+}
+
+// validateFilter checks the range, timezone and drill-down filters of a
+// report filter and normalizes the range to UTC.
+func validateFilter(filter *domain.AnalyticsFilter) error {
+	if !filter.From.Before(filter.To) {
+		return fmt.Errorf("%w: from must be before to", domain.ErrValidation)
+	}
+
+	if filter.Timezone == "" {
+		filter.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(filter.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", domain.ErrValidation, filter.Timezone)
+	}
+
+	for dimension := range filter.Filters {
+		if !slices.Contains(domain.BreakdownDimensions, dimension) {
+			return fmt.Errorf("%w: cannot filter by %q", domain.ErrValidation, dimension)
+		}
+	}
+
+	filter.From = filter.From.UTC()
+	filter.To = filter.To.UTC()
+
+	return nil
+}
+
+// validateSeriesFilter additionally checks the interval of a time series filter.
+func validateSeriesFilter(filter *domain.AnalyticsFilter) error {
+	if err := validateFilter(filter); err != nil {
+		return err
+	}
+
+	if filter.Interval == "" {
+		filter.Interval = domain.IntervalDay
+	}
+	length, ok := intervalLengths[filter.Interval]
+	if !ok {
+		return fmt.Errorf("%w: interval must be one of hour, day, week, month", domain.ErrValidation)
+	}
+	if filter.To.Sub(filter.From)/length > maxSeriesBuckets {
+		return fmt.Errorf("%w: range is too long for interval %s", domain.ErrValidation, filter.Interval)
+	}
+
+	return nil
+}
+
+func compareStats(current, previous *domain.Stats) domain.StatsChange {
+	return domain.StatsChange{
+		TotalVisits:          relativeChange(float64(current.TotalVisits), float64(previous.TotalVisits)),
+		UniqueUsers:          relativeChange(float64(current.UniqueUsers), float64(previous.UniqueUsers)),
+		AvgDuration:          relativeChange(current.AvgDuration, previous.AvgDuration),
+		AvgActiveDuration:    relativeChange(current.AvgActiveDuration, previous.AvgActiveDuration),
+		MedianActiveDuration: relativeChange(current.MedianActiveDuration, previous.MedianActiveDuration),
+		P90ActiveDuration:    relativeChange(current.P90ActiveDuration, previous.P90ActiveDuration),
+		AvgActions:           relativeChange(current.AvgActions, previous.AvgActions),
+		PagesPerSession:      relativeChange(current.PagesPerSession, previous.PagesPerSession),
+		BounceRate:           relativeChange(current.BounceRate, previous.BounceRate),
+		ReturningRatio:       relativeChange(current.ReturningRatio, previous.ReturningRatio),
+	}
+}
+
+func relativeChange(current, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := (current - previous) / previous
+	return &change
+}
+
+const (
+	maxEventNameLength     = 100
+	maxEventProperties     = 25
+	maxPropertyKeyLength   = 50
+	maxPropertyValueLength = 500
+	maxStoredActions       = 50
+	// maxActionAge bounds how long ago a reported action can have happened.
+	maxActionAge = 24 * time.Hour
+	// Widths of the link_clicks url and host columns.
+	maxLinkURLLength  = 500
+	maxLinkHostLength = 255
+)
+
+// validateEvent checks an incoming event and normalizes its timestamp.
+// Property values must be strings, numbers, booleans or null.
+func validateEvent(event *domain.Event) error {
+	if event.SessionID == "" {
+		return fmt.Errorf("%w: session_id is required", domain.ErrValidation)
+	}
+	if len(event.SessionID) > 100 {
+		return fmt.Errorf("%w: session_id is too long", domain.ErrValidation)
+	}
+	if event.Name == "" {
+		return fmt.Errorf("%w: name is required", domain.ErrValidation)
+	}
+	if len(event.Name) > maxEventNameLength {
+		return fmt.Errorf("%w: name must be at most %d characters", domain.ErrValidation, maxEventNameLength)
+	}
+	if len(event.Properties) > maxEventProperties {
+		return fmt.Errorf("%w: at most %d properties are allowed", domain.ErrValidation, maxEventProperties)
+	}
+
+	for key, value := range event.Properties {
+		if key == "" || len(key) > maxPropertyKeyLength {
+			return fmt.Errorf("%w: property names must be 1-%d characters", domain.ErrValidation, maxPropertyKeyLength)
+		}
+		switch v := value.(type) {
+		case nil, bool, float64:
+		case string:
+			if len(v) > maxPropertyValueLength {
+				return fmt.Errorf("%w: property %q is too long", domain.ErrValidation, key)
+			}
+		default:
+			return fmt.Errorf("%w: property %q must be a string, number, boolean or null", domain.ErrValidation, key)
+		}
+	}
+
+	if event.Properties == nil {
+		event.Properties = map[string]any{}
+	}
+
+	if event.Name == domain.EventPageview {
+		path, _ := event.Properties["path"].(string)
+		if path == "" {
+			return fmt.Errorf("%w: pageview requires a path property", domain.ErrValidation)
+		}
+		event.Properties["path"] = getPath(path)
+	}
+
+	if event.Name == domain.EventOutbound || event.Name == domain.EventDownload {
+		link, err := linkURL(event.Properties["url"])
+		if err != nil {
+			return fmt.Errorf("%w: %s %v", domain.ErrValidation, event.Name, err)
+		}
+		event.Properties["url"] = link
+		if path, ok := event.Properties["path"].(string); ok {
+			event.Properties["path"] = getPath(path)
+		}
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	event.Timestamp = event.Timestamp.UTC()
+
+	return nil
+}
+
 func getOS(ua string) string {
 	if ua == "" {
 		return "Unknown"
@@ -202,22 +1047,90 @@ func getOS(ua string) string {
 
 	os := strings.ToLower(agent.OS())
 
+	// iOS reports itself "like Mac OS X", so it has to be matched first.
 	switch {
+	case strings.Contains(os, "iphone") || agent.Model() == "iPad" || strings.Contains(strings.ToLower(ua), "ipad"):
+		return "iOS"
+	case strings.Contains(os, "android"):
+		return "Android"
 	case strings.Contains(os, "windows"):
 		return "Windows"
 	case strings.Contains(os, "mac os") || strings.Contains(os, "macos"):
 		return "macOS"
-	case strings.Contains(os, "linux"):
+	case strings.Contains(os, "linux") || strings.Contains(os, "ubuntu") || strings.Contains(os, "fedora"):
 		return "Linux"
-	case strings.Contains(os, "android"):
-		return "Android"
-	case strings.Contains(os, "iphone") || strings.Contains(ua, "ipad"):
-		return "iOS"
 	default:
 		return "Unknown"
 	}
 }
 
+// linkURL checks the target of an outbound link or download and drops its
+// credentials, query and fragment, so clicks on the same target add up.
+func linkURL(value any) (string, error) {
+	raw, _ := value.(string)
+	if raw == "" {
+		return "", errors.New("requires a url property")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("url must be an absolute http or https URL")
+	}
+	if len(u.Hostname()) > maxLinkHostLength {
+		return "", fmt.Errorf("url host must be at most %d characters", maxLinkHostLength)
+	}
+
+	link := url.URL{
+		Scheme: u.Scheme,
+		Host:   strings.ToLower(u.Host),
+		Path:   u.Path,
+	}
+
+	if len(link.String()) > maxLinkURLLength {
+		return "", fmt.Errorf("url must be at most %d characters", maxLinkURLLength)
+	}
+
+	return link.String(), nil
+}
+
+// getPath returns the path of a URL or path without query and fragment.
+func getPath(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+
+	return u.Path
+}
+
+func getBrowser(ua string) string {
+	if ua == "" {
+		return "Unknown"
+	}
+
+	name, _ := useragent.New(ua).Browser()
+	if name == "" {
+		return "Unknown"
+	}
+
+	return name
+}
+
+func channelSummary(a domain.Attribution) string {
+	summary := a.Channel
+	if a.Source != "" {
+		summary += " / " + a.Source
+	}
+	if a.UTMCampaign != "" {
+		summary += " (" + a.UTMCampaign + ")"
+	}
+	return summary
+}
+
 func actionsSummary(actions map[string]int) string {
 	if len(actions) == 0 {
 		return ""
@@ -255,3 +1168,38 @@ func getActionsCount(actions map[string]int) int {
 
 	return count
 }
+
+// actionsFirstSeen turns the ages the client reported for actions into the
+// times they were first taken, on the server clock. Missing or implausible
+// ages are left out.
+func actionsFirstSeen(actions map[string]int, ages map[string]float64, at time.Time) map[string]time.Time {
+	firstSeen := make(map[string]time.Time, len(actions))
+
+	for name := range actions {
+		age, ok := ages[name]
+		if !ok || age < 0 || age > maxActionAge.Seconds() {
+			continue
+		}
+		firstSeen[name] = at.Add(-time.Duration(age * float64(time.Second)))
+	}
+
+	return firstSeen
+}
+
+// storedActions returns the actions worth persisting by name: at most
+// maxStoredActions of them, with names that fit the visit_actions table.
+func storedActions(actions map[string]int) map[string]int {
+	stored := make(map[string]int, min(len(actions), maxStoredActions))
+
+	for name, count := range actions {
+		if len(stored) == maxStoredActions {
+			break
+		}
+		if name == "" || len(name) > maxEventNameLength || count <= 0 {
+			continue
+		}
+		stored[name] = count
+	}
+
+	return stored
+}
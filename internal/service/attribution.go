@@ -0,0 +1,142 @@
+package service
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/ramisoul84/emil-server/internal/domain"
+)
+
+// searchEngines maps a host label to the engine name, e.g. "google" matches
+// google.com, google.de and www.google.co.uk.
+var searchEngines = map[string]string{
+	"google":     "Google",
+	"bing":       "Bing",
+	"duckduckgo": "DuckDuckGo",
+	"yahoo":      "Yahoo",
+	"yandex":     "Yandex",
+	"baidu":      "Baidu",
+	"ecosia":     "Ecosia",
+	"qwant":      "Qwant",
+	"startpage":  "Startpage",
+}
+
+// socialNetworks maps a registrable domain to the network name.
+var socialNetworks = map[string]string{
+	"facebook.com":         "Facebook",
+	"fb.me":                "Facebook",
+	"instagram.com":        "Instagram",
+	"twitter.com":          "X",
+	"x.com":                "X",
+	"t.co":                 "X",
+	"linkedin.com":         "LinkedIn",
+	"lnkd.in":              "LinkedIn",
+	"reddit.com":           "Reddit",
+	"youtube.com":          "YouTube",
+	"github.com":           "GitHub",
+	"news.ycombinator.com": "Hacker News",
+	"t.me":                 "Telegram",
+	"telegram.org":         "Telegram",
+	"web.whatsapp.com":     "WhatsApp",
+	"vk.com":               "VK",
+	"xing.com":             "XING",
+	"medium.com":           "Medium",
+	"dev.to":               "DEV",
+}
+
+// Widths of the attribution columns of visits.
+const (
+	maxReferrerHostLength = 255
+	maxSourceLength       = 100
+	maxUTMLength          = 255
+)
+
+var paidMediums = []string{"cpc", "ppc", "paid", "paidsearch", "paid_search", "paid-social", "paid_social", "display", "cpm"}
+
+// attribute derives the traffic channel and source of a visit from its
+// referrer and the utm_* parameters of the landing URL. Values are cut to
+// the width of their columns.
+func attribute(referrer, landingURL string) domain.Attribution {
+	a := domain.Attribution{
+		Referrer:     referrer,
+		ReferrerHost: truncate(getReferrerHost(referrer), maxReferrerHostLength),
+	}
+
+	var landingHost string
+	if u, err := url.Parse(landingURL); err == nil {
+		landingHost = strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+		query := u.Query()
+		a.UTMSource = truncate(query.Get("utm_source"), maxUTMLength)
+		a.UTMMedium = truncate(query.Get("utm_medium"), maxUTMLength)
+		a.UTMCampaign = truncate(query.Get("utm_campaign"), maxUTMLength)
+		a.UTMTerm = truncate(query.Get("utm_term"), maxUTMLength)
+		a.UTMContent = truncate(query.Get("utm_content"), maxUTMLength)
+	}
+
+	// Navigation inside the site is not a referral.
+	if a.ReferrerHost != "" && a.ReferrerHost == landingHost {
+		a.ReferrerHost = ""
+	}
+
+	a.Channel, a.Source = classifyHost(a.ReferrerHost)
+
+	if a.UTMSource != "" || a.UTMMedium != "" || a.UTMCampaign != "" {
+		medium := strings.ToLower(a.UTMMedium)
+		switch {
+		case slices.Contains(paidMediums, medium):
+			a.Channel = domain.ChannelPaid
+		case medium == "email" || medium == "newsletter":
+			a.Channel = domain.ChannelEmail
+		case medium == "social":
+			a.Channel = domain.ChannelSocial
+		case a.Channel == domain.ChannelDirect:
+			a.Channel = domain.ChannelCampaign
+		}
+		if a.Source == "" {
+			a.Source = a.UTMSource
+		}
+	}
+	a.Source = truncate(a.Source, maxSourceLength)
+
+	return a
+}
+
+// classifyHost returns the channel and source name for a normalized referrer host.
+func classifyHost(host string) (string, string) {
+	if host == "" {
+		return domain.ChannelDirect, ""
+	}
+
+	for domainName, name := range socialNetworks {
+		if host == domainName || strings.HasSuffix(host, "."+domainName) {
+			return domain.ChannelSocial, name
+		}
+	}
+
+	for _, label := range strings.Split(host, ".") {
+		if name, ok := searchEngines[label]; ok {
+			return domain.ChannelSearch, name
+		}
+	}
+	if host == "search.brave.com" {
+		return domain.ChannelSearch, "Brave"
+	}
+
+	return domain.ChannelReferral, host
+}
+
+// getReferrerHost returns the lower-cased referrer host without "www.",
+// or an empty string for direct visits.
+func getReferrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
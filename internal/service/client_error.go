@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ramisoul84/emil-server/internal/domain"
+)
+
+const (
+	maxErrorMessageLength = 2000
+	maxErrorStackLength   = 10000
+	// errorGroupOccurrences is how many occurrences come with an error group.
+	errorGroupOccurrences = 50
+	// maxErrorAlerts new error groups are notified per errorAlertWindow, the
+	// endpoint is public and anyone can make up new errors.
+	maxErrorAlerts   = 10
+	errorAlertWindow = time.Hour
+)
+
+var (
+	// volatileNumbers matches the ids, counters and positions that make
+	// otherwise identical error messages differ.
+	volatileNumbers = regexp.MustCompile(`\d+`)
+	// hashedAsset matches the content hash in build output file names, like
+	// app.3f9a2c.js or index-B2kXq9aZ.js.
+	hashedAsset = regexp.MustCompile(`([.-])([A-Za-z0-9_]{6,})(\.(?:m?js|css))\b`)
+)
+
+// alertThrottle lets through at most limit alerts per window and counts the
+// ones it held back.
+type alertThrottle struct {
+	mu         sync.Mutex
+	limit      int
+	window     time.Duration
+	start      time.Time
+	sent       int
+	suppressed int
+}
+
+func newAlertThrottle(limit int, window time.Duration) *alertThrottle {
+	return &alertThrottle{limit: limit, window: window}
+}
+
+// allow reports whether an alert may be sent at now and, if so, how many
+// were held back since the last one that was sent.
+func (t *alertThrottle) allow(now time.Time) (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.start) >= t.window {
+		t.start, t.sent = now, 0
+	}
+	if t.sent >= t.limit {
+		t.suppressed++
+		return false, 0
+	}
+
+	t.sent++
+	suppressed := t.suppressed
+	t.suppressed = 0
+	return true, suppressed
+}
+
+// TrackError queues a frontend error for enrichment and grouping.
+func (s *analyticsService) TrackError(ctx context.Context, data *domain.ClientErrorData) error {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "track_error",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling client error")
+
+	data.Message = strings.TrimSpace(data.Message)
+	if data.Message == "" {
+		return fmt.Errorf("%w: message is required", domain.ErrValidation)
+	}
+	if len(data.SessionID) > maxSessionID {
+		return fmt.Errorf("%w: session_id must be at most %d characters", domain.ErrValidation, maxSessionID)
+	}
+
+	now := time.Now()
+
+	err := s.ingest.Submit(ctx, "client_error", func(ctx context.Context) error {
+		return s.processClientError(ctx, data, now)
+	})
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to queue client error")
+		return err
+	}
+
+	return nil
+}
+
+func (s *analyticsService) processClientError(ctx context.Context, data *domain.ClientErrorData, now time.Time) error {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "process_client_error",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	ip := ctx.Value("ip").(string)
+	geo := s.locator.Lookup(ctx, ip)
+
+	// Crawlers run scripts in odd environments, their errors are noise.
+	if isBot, reason := classifyUserAgent(data.UserAgent, geo.ASN); isBot {
+		logger.Info().Str("reason", reason).Msg("Dropping client error from bot")
+		return nil
+	}
+
+	message := truncate(data.Message, maxErrorMessageLength)
+	source := truncate(data.Source, maxPathLength)
+
+	group := &domain.ErrorGroup{
+		Fingerprint: errorFingerprint(data),
+		Message:     message,
+		Source:      source,
+		Line:        data.Line,
+		Column:      data.Column,
+	}
+	occurrence := &domain.ErrorOccurrence{
+		SessionID: data.SessionID,
+		Path:      truncate(getPath(data.URL), maxPathLength),
+		Message:   message,
+		Stack:     truncate(data.Stack, maxErrorStackLength),
+		Source:    source,
+		Line:      data.Line,
+		Column:    data.Column,
+		Browser:   getBrowser(data.UserAgent),
+		OS:        getOS(data.UserAgent),
+		Country:   geo.Country,
+		City:      geo.City,
+		Time:      now.UTC(),
+	}
+
+	isNew, err := s.repo.SaveClientError(ctx, group, occurrence)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to save client error")
+		return err
+	}
+
+	if !isNew {
+		return nil
+	}
+
+	ok, suppressed := s.errorAlerts.allow(time.Now())
+	if !ok {
+		logger.Warn().Int64("group", group.ID).Msg("Too many new client errors, not notifying")
+		return nil
+	}
+
+	msg := fmt.Sprintf(
+		"🐞 *New Frontend Error*\n\n"+
+			"🆔 *Group:* %d\n"+
+			"📄 *Page:* %s\n"+
+			"📱 *Browser:* %s on %s\n"+
+			"📍 *Country:* %s\n"+
+			"```\n%s\n%s\n```"+
+			"%s",
+		group.ID,
+		occurrence.Path,
+		occurrence.Browser,
+		occurrence.OS,
+		occurrence.Country,
+		strings.ReplaceAll(truncate(message, 500), "`", "'"),
+		strings.ReplaceAll(errorLocation(source, data.Line, data.Column), "`", "'"),
+		suppressedErrorAlerts(suppressed),
+	)
+
+	if err := s.bot.Notify(context.Background(), msg); err != nil {
+		logger.Error().Err(err).Msg("Failed to send bot notification")
+	}
+
+	return nil
+}
+
+func (s *analyticsService) ListErrorGroups(ctx context.Context, filter *domain.AnalyticsFilter, limit, offset int) ([]*domain.ErrorGroup, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "list_error_groups",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling list error groups")
+
+	if err := validateFilter(filter); err != nil {
+		logger.Warn().Err(err).Msg("Invalid error groups filter")
+		return nil, err
+	}
+
+	groups, err := s.repo.ListErrorGroups(ctx, filter, limit, offset)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list error groups")
+		return nil, domain.ErrInternal
+	}
+
+	return groups, nil
+}
+
+func (s *analyticsService) GetErrorGroup(ctx context.Context, id int64) (*domain.ErrorGroupDetail, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "get_error_group",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling get error group")
+
+	group, err := s.repo.GetErrorGroup(ctx, id, errorGroupOccurrences)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, err
+		}
+		logger.Error().Err(err).Msg("Failed to get error group")
+		return nil, domain.ErrInternal
+	}
+
+	return group, nil
+}
+
+func suppressedErrorAlerts(count int) string {
+	if count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\n_%d more new errors were not notified_", count)
+}
+
+// errorFingerprint identifies errors with the same cause: the message with
+// numbers masked and the script location without its query string. Without
+// a source the first stack frame, with numbers masked, stands in for the
+// location. Content hashes in file names are masked so that groups survive
+// deploys, positions in such build output are left out for the same reason.
+func errorFingerprint(data *domain.ClientErrorData) string {
+	var where string
+	if source, _, _ := strings.Cut(data.Source, "?"); source != "" {
+		source, _, _ = strings.Cut(source, "#")
+		if normalized, hashed := maskAssetHash(source); hashed {
+			where = normalized
+		} else {
+			where = errorLocation(source, data.Line, data.Column)
+		}
+	} else {
+		frame, _ := maskAssetHash(firstStackFrame(data.Stack))
+		where = volatileNumbers.ReplaceAllString(frame, "0")
+	}
+
+	message := volatileNumbers.ReplaceAllString(data.Message, "0")
+	sum := sha256.Sum256([]byte(message + "\n" + where))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// maskAssetHash replaces content hashes in the file names of s and reports
+// whether there were any. Only parts with a digit count as hashes, so names
+// like app.bundle.js stay as they are.
+func maskAssetHash(s string) (string, bool) {
+	hashed := false
+	masked := hashedAsset.ReplaceAllStringFunc(s, func(match string) string {
+		parts := hashedAsset.FindStringSubmatch(match)
+		if !strings.ContainsAny(parts[2], "0123456789") {
+			return match
+		}
+		hashed = true
+		return parts[1] + "[hash]" + parts[3]
+	})
+	return masked, hashed
+}
+
+// firstStackFrame returns the first frame of a stack trace. V8 starts stacks
+// with the error message and marks frames with "at ", Firefox and Safari
+// write frames as function@location.
+func firstStackFrame(stack string) string {
+	for _, line := range strings.Split(stack, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "at ") || strings.Contains(line, "@") {
+			return line
+		}
+	}
+	return ""
+}
+
+func errorLocation(source string, line, column int) string {
+	return fmt.Sprintf("%s:%d:%d", source, line, column)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/mssola/useragent"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ramisoul84/emil-server/internal/domain"
+)
+
+var botVisitsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "analytics_bot_visits_total",
+		Help: "Total visits classified as bots or crawlers",
+	},
+	[]string{"reason"},
+)
+
+func init() {
+	prometheus.MustRegister(botVisitsTotal)
+}
+
+// botUserAgents are user-agent fragments of HTTP libraries, headless
+// browsers and monitoring services that useragent.Bot() does not catch.
+var botUserAgents = []string{
+	"crawler", "spider", "slurp", "scraper",
+	"headlesschrome", "phantomjs", "selenium", "puppeteer", "playwright", "lighthouse",
+	"curl/", "wget/", "httpie/", "python-requests", "python-urllib", "aiohttp",
+	"go-http-client", "java/", "okhttp", "axios/", "node-fetch", "undici",
+	"uptimerobot", "pingdom", "statuscake", "site24x7", "betteruptime", "checkly",
+	"uptime-kuma", "hetrixtools", "freshping", "updown.io", "datadogsynthetics",
+	"newrelicpinger", "nagios", "zabbix", "monitis",
+}
+
+// datacenterASNs are autonomous systems of cloud and hosting providers.
+// Residential visitors do not browse from them, scripted traffic often does.
+var datacenterASNs = map[int]string{
+	16509:  "Amazon AWS",
+	14618:  "Amazon AWS",
+	396982: "Google Cloud",
+	8075:   "Microsoft Azure",
+	14061:  "DigitalOcean",
+	16276:  "OVH",
+	24940:  "Hetzner",
+	63949:  "Akamai Linode",
+	20473:  "Vultr",
+	45102:  "Alibaba Cloud",
+	31898:  "Oracle Cloud",
+	12876:  "Scaleway",
+	51167:  "Contabo",
+	132203: "Tencent Cloud",
+	60781:  "Leaseweb",
+	9009:   "M247",
+}
+
+const (
+	// maxActionsPerSecond is the highest action rate a person can keep up.
+	maxActionsPerSecond = 5
+	// minHumanDuration is the shortest visit-end duration a browser reports
+	// for a real page view.
+	minHumanDuration = 0.5
+)
+
+// classifyUserAgent reports whether a visit is automated judging by its
+// user-agent and network, along with the reason.
+func classifyUserAgent(ua string, asn int) (bool, string) {
+	if strings.TrimSpace(ua) == "" {
+		return true, domain.BotReasonUserAgent
+	}
+
+	if useragent.New(ua).Bot() {
+		return true, domain.BotReasonUserAgent
+	}
+
+	lower := strings.ToLower(ua)
+	for _, fragment := range botUserAgents {
+		if strings.Contains(lower, fragment) {
+			return true, domain.BotReasonUserAgent
+		}
+	}
+
+	if _, ok := datacenterASNs[asn]; ok {
+		return true, domain.BotReasonDatacenter
+	}
+
+	return false, ""
+}
+
+// classifyBehavior reports whether a finished visit looks automated judging
+// by its duration and action rate, along with the reason.
+func classifyBehavior(duration, activeDuration float64, actionsCount int) (bool, string) {
+	if duration < minHumanDuration && activeDuration == 0 {
+		return true, domain.BotReasonZeroDuration
+	}
+
+	if actionsCount > 0 && float64(actionsCount) > maxActionsPerSecond*max(activeDuration, duration) {
+		return true, domain.BotReasonActionRate
+	}
+
+	return false, ""
+}
+
+// classifyVisit flags the visit as a bot when the user-agent, network or,
+// for finished visits, behavior gives it away.
+func classifyVisit(data *domain.Data, ua string, asn int, finished bool) {
+	isBot, reason := classifyUserAgent(ua, asn)
+	if !isBot && finished {
+		isBot, reason = classifyBehavior(data.Duration, data.ActiveDuration, data.ActionsCount)
+	}
+
+	data.IsBot = isBot
+	data.BotReason = reason
+}
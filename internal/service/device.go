@@ -0,0 +1,88 @@
+package service
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mssola/useragent"
+	"github.com/ramisoul84/emil-server/internal/domain"
+)
+
+const (
+	maxScreenSize     = 100000
+	maxLanguageLength = 35
+	maxTimezoneLength = 50
+	maxVersionLength  = 50
+)
+
+// getDevice parses the user-agent into browser and OS versions, device class
+// and engine. Client-reported screen details are added by withClientDevice.
+func getDevice(ua string) domain.Device {
+	if ua == "" {
+		return domain.Device{DeviceType: domain.DeviceDesktop}
+	}
+
+	agent := useragent.New(ua)
+	_, browserVersion := agent.Browser()
+	engine, _ := agent.Engine()
+
+	return domain.Device{
+		BrowserVersion: truncate(browserVersion, maxVersionLength),
+		OSVersion:      truncate(agent.OSInfo().Version, maxVersionLength),
+		DeviceType:     getDeviceType(agent, ua),
+		Engine:         truncate(engine, maxVersionLength),
+	}
+}
+
+// getDeviceType tells tablets from phones, which useragent reports alike.
+// Android tablets leave "Mobile" out of their user-agent.
+func getDeviceType(agent *useragent.UserAgent, ua string) string {
+	lower := strings.ToLower(ua)
+
+	switch {
+	case agent.Model() == "iPad" || strings.Contains(lower, "ipad") || strings.Contains(lower, "tablet"):
+		return domain.DeviceTablet
+	case strings.Contains(lower, "android") && !strings.Contains(lower, "mobile"):
+		return domain.DeviceTablet
+	case agent.Mobile():
+		return domain.DeviceMobile
+	default:
+		return domain.DeviceDesktop
+	}
+}
+
+// withClientDevice adds the screen, viewport, language and timezone reported
+// by the browser, dropping values that cannot be real.
+func withClientDevice(device domain.Device, data *domain.VisitStartData) domain.Device {
+	if validScreenSize(data.ScreenWidth, data.ScreenHeight) {
+		device.ScreenWidth = data.ScreenWidth
+		device.ScreenHeight = data.ScreenHeight
+	}
+	if validScreenSize(data.ViewportWidth, data.ViewportHeight) {
+		device.ViewportWidth = data.ViewportWidth
+		device.ViewportHeight = data.ViewportHeight
+	}
+	if len(data.Language) <= maxLanguageLength {
+		device.Language = data.Language
+	}
+	if len(data.Timezone) <= maxTimezoneLength {
+		device.Timezone = data.Timezone
+	}
+
+	return device
+}
+
+func validScreenSize(width, height int) bool {
+	return width > 0 && height > 0 && width <= maxScreenSize && height <= maxScreenSize
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
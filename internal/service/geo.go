@@ -0,0 +1,35 @@
+package service
+
+import (
+	"github.com/ramisoul84/emil-server/internal/domain"
+	"github.com/ramisoul84/emil-server/pkg/location"
+)
+
+const (
+	maxRegionLength = 100
+	maxISPLength    = 255
+)
+
+// storedGeo picks the location details of a lookup that are persisted with
+// visits and messages. Coordinates of 0,0 mean the provider had none.
+func storedGeo(geo location.GeoInfo) domain.GeoInfo {
+	stored := domain.GeoInfo{
+		Region: truncate(geo.Region, maxRegionLength),
+		ASN:    geo.ASN,
+		ISP:    truncate(geo.ISP, maxISPLength),
+	}
+
+	if len(geo.CountryCode) == 2 {
+		stored.CountryCode = geo.CountryCode
+	}
+	if len(geo.Timezone) <= maxTimezoneLength {
+		stored.GeoTimezone = geo.Timezone
+	}
+	if geo.Latitude != 0 || geo.Longitude != 0 {
+		latitude, longitude := geo.Latitude, geo.Longitude
+		stored.Latitude = &latitude
+		stored.Longitude = &longitude
+	}
+
+	return stored
+}
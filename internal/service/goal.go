@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ramisoul84/emil-server/internal/domain"
+	"github.com/ramisoul84/emil-server/pkg/logger"
+)
+
+type goalRepository interface {
+	Create(ctx context.Context, goal *domain.Goal) error
+	Get(ctx context.Context, id int) (*domain.Goal, error)
+	Update(ctx context.Context, goal *domain.Goal) error
+	Delete(ctx context.Context, id int) error
+	List(ctx context.Context) ([]*domain.Goal, error)
+	GetFunnel(ctx context.Context, filter *domain.AnalyticsFilter, goals []*domain.Goal) (int, []int, error)
+}
+
+type goalService struct {
+	repo   goalRepository
+	logger logger.Logger
+}
+
+func NewGoalService(repo goalRepository) *goalService {
+	return &goalService{
+		repo:   repo,
+		logger: logger.Get(),
+	}
+}
+
+const (
+	maxGoalNameLength  = 100
+	maxGoalMatchLength = 500
+	maxFunnelSteps     = 10
+)
+
+func (s *goalService) CreateGoal(ctx context.Context, goal *domain.Goal) error {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_service",
+			"method":     "create_goal",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling create goal")
+
+	if err := validateGoal(goal); err != nil {
+		logger.Warn().Err(err).Msg("Invalid goal")
+		return err
+	}
+	goal.CreatedAt = time.Now().UTC()
+
+	if err := s.repo.Create(ctx, goal); err != nil {
+		return domain.ErrInternal
+	}
+
+	return nil
+}
+
+func (s *goalService) GetGoal(ctx context.Context, id int) (*domain.Goal, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_service",
+			"method":     "get_goal",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling get goal")
+
+	return s.repo.Get(ctx, id)
+}
+
+func (s *goalService) UpdateGoal(ctx context.Context, goal *domain.Goal) error {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_service",
+			"method":     "update_goal",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling update goal")
+
+	if err := validateGoal(goal); err != nil {
+		logger.Warn().Err(err).Msg("Invalid goal")
+		return err
+	}
+
+	return s.repo.Update(ctx, goal)
+}
+
+func (s *goalService) DeleteGoal(ctx context.Context, id int) error {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_service",
+			"method":     "delete_goal",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling delete goal")
+
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *goalService) ListGoals(ctx context.Context) ([]*domain.Goal, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_service",
+			"method":     "list_goals",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling list goals")
+
+	return s.repo.List(ctx)
+}
+
+// Funnel reports how many sessions in the filter range completed each step,
+// given by goal IDs, after completing every step before it in order.
+func (s *goalService) Funnel(ctx context.Context, filter *domain.AnalyticsFilter, goalIDs []int) (*domain.FunnelReport, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "goal_service",
+			"method":     "funnel",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Ints("goals", goalIDs).Msg("➡️  [Service] Handling funnel")
+
+	if err := validateFilter(filter); err != nil {
+		logger.Warn().Err(err).Msg("Invalid funnel filter")
+		return nil, err
+	}
+
+	if len(goalIDs) == 0 || len(goalIDs) > maxFunnelSteps {
+		return nil, fmt.Errorf("%w: a funnel needs between 1 and %d steps", domain.ErrValidation, maxFunnelSteps)
+	}
+
+	goals := make([]*domain.Goal, 0, len(goalIDs))
+	for _, id := range goalIDs {
+		goal, err := s.repo.Get(ctx, id)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return nil, fmt.Errorf("%w: goal %d not found", domain.ErrValidation, id)
+			}
+			return nil, domain.ErrInternal
+		}
+		goals = append(goals, goal)
+	}
+
+	total, counts, err := s.repo.GetFunnel(ctx, filter, goals)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get funnel")
+		return nil, domain.ErrInternal
+	}
+
+	loc, _ := time.LoadLocation(filter.Timezone)
+	report := &domain.FunnelReport{
+		From:          filter.From.In(loc),
+		To:            filter.To.In(loc),
+		TotalSessions: total,
+		Steps:         make([]*domain.FunnelStep, len(goals)),
+	}
+
+	previous := total
+	for i, goal := range goals {
+		report.Steps[i] = &domain.FunnelStep{
+			Goal:              goal,
+			Sessions:          counts[i],
+			Conversion:        ratio(counts[i], previous),
+			OverallConversion: ratio(counts[i], total),
+			DropOff:           previous - counts[i],
+		}
+		previous = counts[i]
+	}
+
+	return report, nil
+}
+
+func validateGoal(goal *domain.Goal) error {
+	goal.Name = strings.TrimSpace(goal.Name)
+	goal.Match = strings.TrimSpace(goal.Match)
+
+	if goal.Name == "" {
+		return fmt.Errorf("%w: name is required", domain.ErrValidation)
+	}
+	if len(goal.Name) > maxGoalNameLength {
+		return fmt.Errorf("%w: name must be at most %d characters", domain.ErrValidation, maxGoalNameLength)
+	}
+	if !slices.Contains(domain.GoalTypes, goal.Type) {
+		return fmt.Errorf("%w: type must be one of %s", domain.ErrValidation, strings.Join(domain.GoalTypes, ", "))
+	}
+
+	switch goal.Type {
+	case domain.GoalTypeMessage:
+		goal.Match = ""
+	case domain.GoalTypePageview:
+		goal.Match = getPath(goal.Match)
+	}
+
+	if goal.Type != domain.GoalTypeMessage && goal.Match == "" {
+		return fmt.Errorf("%w: match is required", domain.ErrValidation)
+	}
+	if len(goal.Match) > maxGoalMatchLength {
+		return fmt.Errorf("%w: match must be at most %d characters", domain.ErrValidation, maxGoalMatchLength)
+	}
+
+	return nil
+}
+
+func ratio(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
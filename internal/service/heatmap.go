@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ramisoul84/emil-server/internal/domain"
+)
+
+const (
+	// maxClicksPerPageview is the maximum number of clicks accepted per page view.
+	maxClicksPerPageview = 200
+	maxSelectorLength    = 500
+	// heatmapSelectors is how many of the most clicked selectors come with a page.
+	heatmapSelectors = 20
+)
+
+// scrollReachDepths are the depths, in percent of the page, the scroll
+// report counts page views for.
+var scrollReachDepths = []int{25, 50, 75, 100}
+
+// TrackInteractions stores the clicks and scroll depth of a page view.
+// Crawlers are dropped by user-agent, they neither click nor read.
+func (s *analyticsService) TrackInteractions(ctx context.Context, data *domain.InteractionData) error {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "track_interactions",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Debug().Msg("➡️  [Service] Handling page interactions")
+
+	clicks, scroll, err := interactionSamples(data, time.Now().UTC())
+	if err != nil {
+		logger.Warn().Err(err).Msg("Invalid page interactions")
+		return err
+	}
+
+	if isBot, reason := classifyUserAgent(data.UserAgent, 0); isBot {
+		logger.Info().Str("reason", reason).Msg("Dropping page interactions from bot")
+		return nil
+	}
+
+	if len(clicks) == 0 && scroll == nil {
+		return nil
+	}
+
+	if err := s.repo.SaveInteractions(ctx, clicks, scroll); err != nil {
+		logger.Error().Err(err).Msg("Failed to save page interactions")
+		return domain.ErrInternal
+	}
+
+	return nil
+}
+
+// Heatmap reports click grids, top selectors and scroll reach for the pages
+// with the most interactions.
+func (s *analyticsService) Heatmap(ctx context.Context, filter *domain.HeatmapFilter) (*domain.HeatmapReport, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "heatmap",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling heatmap report")
+
+	if err := validateFilter(&filter.AnalyticsFilter); err != nil {
+		logger.Warn().Err(err).Msg("Invalid heatmap filter")
+		return nil, err
+	}
+	if len(filter.Filters) > 0 {
+		return nil, fmt.Errorf("%w: heatmaps can only be filtered by path and device_type", domain.ErrValidation)
+	}
+
+	pages, err := s.repo.GetHeatmap(ctx, filter, heatmapSelectors)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get heatmap")
+		return nil, domain.ErrInternal
+	}
+
+	for _, page := range pages {
+		if page.Scroll != nil {
+			page.Scroll.Reach = scrollReach(page.Scroll)
+		}
+	}
+
+	loc, _ := time.LoadLocation(filter.Timezone)
+
+	return &domain.HeatmapReport{
+		From:     filter.From.In(loc),
+		To:       filter.To.In(loc),
+		Timezone: filter.Timezone,
+		Grid:     filter.Grid,
+		Pages:    pages,
+	}, nil
+}
+
+// interactionSamples validates the interactions of a page view and
+// normalizes them. The scroll sample is nil when the page height is unknown.
+func interactionSamples(data *domain.InteractionData, now time.Time) ([]*domain.ClickSample, *domain.ScrollSample, error) {
+	path := getPath(data.URL)
+	if path == "" {
+		return nil, nil, fmt.Errorf("%w: url is required", domain.ErrValidation)
+	}
+	if len(data.SessionID) > maxSessionID {
+		return nil, nil, fmt.Errorf("%w: session_id must be at most %d characters", domain.ErrValidation, maxSessionID)
+	}
+	if len(data.Clicks) > maxClicksPerPageview {
+		return nil, nil, fmt.Errorf("%w: at most %d clicks are accepted per page view", domain.ErrValidation, maxClicksPerPageview)
+	}
+	if !validScreenSize(data.ViewportWidth, data.ViewportHeight) {
+		return nil, nil, fmt.Errorf("%w: viewport_width and viewport_height are required", domain.ErrValidation)
+	}
+	if data.PageHeight < 0 || data.PageHeight > maxScreenSize*10 {
+		return nil, nil, fmt.Errorf("%w: page_height is out of range", domain.ErrValidation)
+	}
+
+	path = truncate(path, maxPathLength)
+	deviceType := getDevice(data.UserAgent).DeviceType
+	// A page is never shorter than the viewport showing it.
+	pageHeight := max(data.PageHeight, data.ViewportHeight)
+
+	clicks := make([]*domain.ClickSample, 0, len(data.Clicks))
+	for i, click := range data.Clicks {
+		if click == nil {
+			return nil, nil, fmt.Errorf("%w: click %d is empty", domain.ErrValidation, i)
+		}
+		if click.X < 0 || click.X > data.ViewportWidth || click.Y < 0 || click.Y > pageHeight {
+			return nil, nil, fmt.Errorf("%w: click %d is outside the page", domain.ErrValidation, i)
+		}
+
+		clicks = append(clicks, &domain.ClickSample{
+			SessionID:  data.SessionID,
+			Path:       path,
+			X:          float64(click.X) / float64(data.ViewportWidth),
+			Y:          float64(click.Y) / float64(pageHeight),
+			Selector:   truncate(strings.TrimSpace(click.Selector), maxSelectorLength),
+			DeviceType: deviceType,
+			Time:       now,
+		})
+	}
+
+	if data.PageHeight == 0 {
+		return clicks, nil, nil
+	}
+	if data.MaxScroll < 0 {
+		return nil, nil, fmt.Errorf("%w: max_scroll must not be negative", domain.ErrValidation)
+	}
+
+	// The deepest point seen is the bottom edge of the viewport.
+	seen := min(data.MaxScroll+data.ViewportHeight, pageHeight)
+	scroll := &domain.ScrollSample{
+		SessionID:  data.SessionID,
+		Path:       path,
+		Depth:      float64(seen) / float64(pageHeight) * 100,
+		DeviceType: deviceType,
+		Time:       now,
+	}
+
+	return clicks, scroll, nil
+}
+
+// scrollReach turns the reached counts of a page into shares of its page views.
+func scrollReach(scroll *domain.ScrollDepth) []*domain.ScrollReach {
+	reached := []int{scroll.Reached25, scroll.Reached50, scroll.Reached75, scroll.Reached100}
+
+	reach := make([]*domain.ScrollReach, 0, len(scrollReachDepths))
+	for i, depth := range scrollReachDepths {
+		reach = append(reach, &domain.ScrollReach{
+			Depth:     depth,
+			Pageviews: reached[i],
+			Share:     ratio(reached[i], scroll.Pageviews),
+		})
+	}
+
+	return reach
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ramisoul84/emil-server/config"
+	"github.com/ramisoul84/emil-server/internal/domain"
+	"github.com/ramisoul84/emil-server/pkg/logger"
+)
+
+var (
+	ingestQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "analytics_ingest_queue_depth",
+			Help: "Number of analytics jobs waiting in the ingest queue",
+		},
+	)
+
+	ingestQueueCapacity = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "analytics_ingest_queue_capacity",
+			Help: "Maximum number of analytics jobs the ingest queue can hold",
+		},
+	)
+
+	ingestDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "analytics_ingest_dropped_total",
+			Help: "Total analytics jobs rejected by the ingest queue",
+		},
+		[]string{"job", "reason"},
+	)
+
+	ingestProcessedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "analytics_ingest_processed_total",
+			Help: "Total analytics jobs processed by the ingest workers",
+		},
+		[]string{"job", "status"},
+	)
+
+	ingestJobDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "analytics_ingest_job_duration_seconds",
+			Help:    "Analytics ingest job duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"job"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		ingestQueueDepth,
+		ingestQueueCapacity,
+		ingestDroppedTotal,
+		ingestProcessedTotal,
+		ingestJobDuration,
+	)
+}
+
+type ingestJob struct {
+	name string
+	ctx  context.Context
+	run  func(ctx context.Context) error
+}
+
+// ingestPipeline is a bounded in-process queue drained by a pool of workers.
+// It moves enrichment and persistence of analytics data out of the HTTP request.
+type ingestPipeline struct {
+	jobs       chan ingestJob
+	workers    int
+	jobTimeout time.Duration
+	wg         sync.WaitGroup
+	mu         sync.RWMutex
+	closed     bool
+	logger     logger.Logger
+}
+
+func NewIngestPipeline(cfg *config.Config) *ingestPipeline {
+	ingestQueueCapacity.Set(float64(cfg.Analytics.IngestQueueSize))
+
+	return &ingestPipeline{
+		jobs:       make(chan ingestJob, cfg.Analytics.IngestQueueSize),
+		workers:    cfg.Analytics.IngestWorkers,
+		jobTimeout: cfg.Analytics.IngestJobTimeout,
+		logger:     logger.Get(),
+	}
+}
+
+// Start launches the worker pool.
+func (p *ingestPipeline) Start() {
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+
+	p.logger.Info().
+		Int("workers", p.workers).
+		Int("queue_size", cap(p.jobs)).
+		Msg("Ingest pipeline started")
+}
+
+// Submit queues a job without blocking. It returns domain.ErrQueueFull when
+// the queue is at capacity and domain.ErrShuttingDown once Shutdown was called.
+// Only the request_id and ip values of ctx are kept, the job never sees the
+// request context itself since it is recycled once the handler returns.
+func (p *ingestPipeline) Submit(ctx context.Context, name string, run func(ctx context.Context) error) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		ingestDroppedTotal.WithLabelValues(name, "shutdown").Inc()
+		return domain.ErrShuttingDown
+	}
+
+	job := ingestJob{
+		name: name,
+		ctx:  detachContext(ctx),
+		run:  run,
+	}
+
+	select {
+	case p.jobs <- job:
+		ingestQueueDepth.Inc()
+		return nil
+	default:
+		ingestDroppedTotal.WithLabelValues(name, "queue_full").Inc()
+		return domain.ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting jobs and waits for the queued ones to be processed
+// or for ctx to expire.
+func (p *ingestPipeline) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	p.logger.Info().Int("pending", len(p.jobs)).Msg("Draining ingest queue")
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.logger.Info().Msg("Ingest queue drained")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("ingest queue not drained, %d jobs left: %w", len(p.jobs), ctx.Err())
+	}
+}
+
+func (p *ingestPipeline) work() {
+	defer p.wg.Done()
+
+	for job := range p.jobs {
+		ingestQueueDepth.Dec()
+		p.process(job)
+	}
+}
+
+func (p *ingestPipeline) process(job ingestJob) {
+	start := time.Now()
+	status := "success"
+
+	defer func() {
+		if r := recover(); r != nil {
+			status = "panic"
+			p.logger.Error().Str("job", job.name).Msgf("Ingest job panicked: %v", r)
+		}
+		ingestProcessedTotal.WithLabelValues(job.name, status).Inc()
+		ingestJobDuration.WithLabelValues(job.name).Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(job.ctx, p.jobTimeout)
+	defer cancel()
+
+	if err := job.run(ctx); err != nil {
+		status = "error"
+		p.logger.Error().Err(err).Str("job", job.name).Msg("Ingest job failed")
+	}
+}
+
+// detachContext copies the values the lower layers rely on into a fresh context.
+func detachContext(ctx context.Context) context.Context {
+	detached := context.Background()
+	for _, key := range []string{"request_id", "ip"} {
+		if value, ok := ctx.Value(key).(string); ok {
+			detached = context.WithValue(detached, key, strings.Clone(value))
+		}
+	}
+	return detached
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/ramisoul84/emil-server/internal/domain"
+)
+
+// liveSubscriberBuffer is how many events a slow subscriber may lag behind
+// before events are dropped for it.
+const liveSubscriberBuffer = 64
+
+// liveHub fans out live analytics events to the connected dashboards.
+type liveHub struct {
+	mu          sync.RWMutex
+	subscribers map[chan domain.LiveEvent]struct{}
+	closed      bool
+}
+
+func NewLiveHub() *liveHub {
+	return &liveHub{
+		subscribers: make(map[chan domain.LiveEvent]struct{}),
+	}
+}
+
+// Subscribe registers a new listener. The channel is closed when the
+// returned unsubscribe function is called or the hub is closed.
+func (h *liveHub) Subscribe() (<-chan domain.LiveEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan domain.LiveEvent, liveSubscriberBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	h.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends the event to every subscriber without blocking.
+func (h *liveHub) Publish(event domain.LiveEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Close disconnects all subscribers so their streams can finish.
+func (h *liveHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/ramisoul84/emil-server/internal/domain"
-	"github.com/ramisoul84/emil-server/pkg/location"
 	"github.com/ramisoul84/emil-server/pkg/logger"
 )
 
@@ -19,16 +18,20 @@ type messageRepository interface {
 }
 
 type messageService struct {
-	repo   messageRepository
-	bot    botNotifier
-	logger logger.Logger
+	repo       messageRepository
+	bot        botNotifier
+	locator    locator
+	anonymizer ipAnonymizer
+	logger     logger.Logger
 }
 
-func NewMessageService(repo messageRepository, bot botNotifier) *messageService {
+func NewMessageService(repo messageRepository, bot botNotifier, locator locator, anonymizer ipAnonymizer) *messageService {
 	return &messageService{
-		repo:   repo,
-		bot:    bot,
-		logger: logger.Get(),
+		repo:       repo,
+		bot:        bot,
+		locator:    locator,
+		anonymizer: anonymizer,
+		logger:     logger.Get(),
 	}
 }
 
@@ -43,14 +46,18 @@ func (s *messageService) CreateMessage(ctx context.Context, message *domain.Mess
 
 	logger.Info().Msg("➡️  [Service] Handling create message")
 
-	ip := ctx.Value("ip").(string)
-	country, city := location.GetFullClientInfo(ip)
-
 	message.Time = time.Now()
+
+	// Geolocation needs the full address, only the anonymized one is kept.
+	geo := s.locator.Lookup(ctx, ctx.Value("ip").(string))
+	ip := s.anonymizer.Anonymize(ctx.Value("ip").(string))
+	country, city := geo.Country, geo.City
+
 	message.Unread = false
 	message.IP = ip
 	message.City = city
 	message.Country = country
+	message.GeoInfo = storedGeo(geo)
 
 	msg := fmt.Sprintf(
 		"📊 *You got a message*\n\n"+
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ramisoul84/emil-server/internal/domain"
+)
+
+const (
+	// maxVitalsMetrics is the maximum number of metrics accepted per page view.
+	maxVitalsMetrics = 20
+	// maxVitalMillis and maxVitalCLS reject values no real page produces.
+	maxVitalMillis = 10 * 60 * 1000
+	maxVitalCLS    = 100
+	maxPathLength  = 500
+	maxSessionID   = 100
+)
+
+// TrackVitals stores the performance metrics measured on a page view,
+// tagged with its path and the device class of the user-agent.
+func (s *analyticsService) TrackVitals(ctx context.Context, data *domain.VitalsData) error {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "track_vitals",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Debug().Msg("➡️  [Service] Handling web vitals")
+
+	samples, err := vitalSamples(data, time.Now().UTC())
+	if err != nil {
+		logger.Warn().Err(err).Msg("Invalid web vitals")
+		return err
+	}
+
+	// Lab runs like Lighthouse and PageSpeed would skew the field data.
+	if isBot, reason := classifyUserAgent(data.UserAgent, 0); isBot {
+		logger.Info().Str("reason", reason).Msg("Dropping web vitals from bot")
+		return nil
+	}
+
+	if err := s.repo.SaveVitals(ctx, samples); err != nil {
+		logger.Error().Err(err).Msg("Failed to save web vitals")
+		return domain.ErrInternal
+	}
+
+	return nil
+}
+
+// WebVitals reports p50, p75 and p95 of each metric per page, over the whole
+// range and per interval bucket.
+func (s *analyticsService) WebVitals(ctx context.Context, filter *domain.VitalsFilter) (*domain.VitalsReport, error) {
+	logger := s.logger.WithFields(
+		map[string]any{
+			"layer":      "analytics_service",
+			"method":     "web_vitals",
+			"request_id": ctx.Value("request_id").(string),
+		},
+	)
+
+	logger.Info().Msg("➡️  [Service] Handling web vitals report")
+
+	if err := validateSeriesFilter(&filter.AnalyticsFilter); err != nil {
+		logger.Warn().Err(err).Msg("Invalid web vitals filter")
+		return nil, err
+	}
+	if len(filter.Filters) > 0 {
+		return nil, fmt.Errorf("%w: web vitals can only be filtered by path and device_type", domain.ErrValidation)
+	}
+
+	summary, series, err := s.repo.GetVitals(ctx, filter)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get web vitals")
+		return nil, domain.ErrInternal
+	}
+
+	loc, _ := time.LoadLocation(filter.Timezone)
+	for _, item := range series {
+		if item.Time != nil {
+			bucket := item.Time.In(loc)
+			item.Time = &bucket
+		}
+	}
+
+	return &domain.VitalsReport{
+		From:     filter.From.In(loc),
+		To:       filter.To.In(loc),
+		Interval: filter.Interval,
+		Timezone: filter.Timezone,
+		Summary:  summary,
+		Series:   series,
+	}, nil
+}
+
+// vitalSamples validates the metrics of a page view and turns them into samples.
+func vitalSamples(data *domain.VitalsData, now time.Time) ([]*domain.VitalSample, error) {
+	path := getPath(data.URL)
+	if path == "" {
+		return nil, fmt.Errorf("%w: url is required", domain.ErrValidation)
+	}
+	if len(data.SessionID) > maxSessionID {
+		return nil, fmt.Errorf("%w: session_id must be at most %d characters", domain.ErrValidation, maxSessionID)
+	}
+	if len(data.Metrics) == 0 || len(data.Metrics) > maxVitalsMetrics {
+		return nil, fmt.Errorf("%w: between 1 and %d metrics are required", domain.ErrValidation, maxVitalsMetrics)
+	}
+
+	deviceType := getDevice(data.UserAgent).DeviceType
+	samples := make([]*domain.VitalSample, 0, len(data.Metrics))
+	for i, metric := range data.Metrics {
+		if metric == nil {
+			return nil, fmt.Errorf("%w: metric %d is empty", domain.ErrValidation, i)
+		}
+
+		name := strings.ToUpper(metric.Name)
+		if !slices.Contains(domain.WebVitals, name) {
+			return nil, fmt.Errorf("%w: metric name must be one of %s", domain.ErrValidation, strings.Join(domain.WebVitals, ", "))
+		}
+
+		limit := float64(maxVitalMillis)
+		if name == domain.VitalCLS {
+			limit = maxVitalCLS
+		}
+		if metric.Value < 0 || metric.Value > limit {
+			return nil, fmt.Errorf("%w: %s value %g is out of range", domain.ErrValidation, name, metric.Value)
+		}
+
+		samples = append(samples, &domain.VitalSample{
+			SessionID:  data.SessionID,
+			Path:       truncate(path, maxPathLength),
+			DeviceType: deviceType,
+			Name:       name,
+			Value:      metric.Value,
+			Time:       now,
+		})
+	}
+
+	return samples, nil
+}
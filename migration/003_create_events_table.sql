@@ -0,0 +1,12 @@
+CREATE TABLE events (
+    id BIGSERIAL PRIMARY KEY,
+    session_id VARCHAR(100) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    properties JSONB NOT NULL DEFAULT '{}',
+    time TIMESTAMP NOT NULL
+);
+
+-- events are linked to visits.session_id, but are usually received before
+-- the visit row is written, so there is no foreign key.
+CREATE INDEX idx_events_session_id_time ON events (session_id, time);
+CREATE INDEX idx_events_name_time ON events (name, time);
@@ -0,0 +1,12 @@
+CREATE TABLE sessions (
+    session_id VARCHAR(100) PRIMARY KEY,
+    user_id VARCHAR(100),
+    started_at TIMESTAMP NOT NULL,
+    last_heartbeat_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
+    active_duration FLOAT NOT NULL DEFAULT 0,
+    actions_count INT NOT NULL DEFAULT 0
+);
+
+-- used by the sweeper to find sessions that went silent
+CREATE INDEX idx_sessions_open_heartbeat ON sessions (last_heartbeat_at) WHERE ended_at IS NULL;
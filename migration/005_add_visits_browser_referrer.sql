@@ -0,0 +1,5 @@
+ALTER TABLE visits
+    ADD COLUMN browser VARCHAR(50),
+    ADD COLUMN referrer_host VARCHAR(255);
+
+CREATE INDEX idx_visits_start_time ON visits (start_time);
@@ -0,0 +1,11 @@
+ALTER TABLE visits
+    ADD COLUMN referrer TEXT,
+    ADD COLUMN channel VARCHAR(20),
+    ADD COLUMN source VARCHAR(100),
+    ADD COLUMN utm_source VARCHAR(255),
+    ADD COLUMN utm_medium VARCHAR(255),
+    ADD COLUMN utm_campaign VARCHAR(255),
+    ADD COLUMN utm_term VARCHAR(255),
+    ADD COLUMN utm_content VARCHAR(255);
+
+CREATE INDEX idx_visits_utm_campaign ON visits (utm_campaign) WHERE utm_campaign IS NOT NULL;
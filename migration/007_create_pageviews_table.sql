@@ -0,0 +1,14 @@
+CREATE TABLE pageviews (
+    id BIGSERIAL PRIMARY KEY,
+    session_id VARCHAR(100) NOT NULL,
+    path VARCHAR(500) NOT NULL,
+    title VARCHAR(500),
+    time TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_pageviews_session_id_time ON pageviews (session_id, time);
+CREATE INDEX idx_pageviews_time ON pageviews (time);
+
+ALTER TABLE visits
+    ADD COLUMN landing_page VARCHAR(500),
+    ADD COLUMN exit_page VARCHAR(500);
@@ -0,0 +1,4 @@
+ALTER TABLE visits ADD COLUMN pageviews INT;
+
+-- used to tell returning visitors apart
+CREATE INDEX idx_visits_user_id_start_time ON visits (user_id, start_time);
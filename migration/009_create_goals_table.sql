@@ -0,0 +1,17 @@
+CREATE TABLE goals (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    match VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- action names and counts sent in VisitData.Actions and heartbeats
+CREATE TABLE visit_actions (
+    session_id VARCHAR(100) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    count INT NOT NULL,
+    PRIMARY KEY (session_id, name)
+);
+
+CREATE INDEX idx_visit_actions_name ON visit_actions (name);
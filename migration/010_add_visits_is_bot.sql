@@ -0,0 +1,6 @@
+ALTER TABLE visits
+    ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN bot_reason VARCHAR(20);
+
+ALTER TABLE sessions
+    ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,11 @@
+ALTER TABLE visits
+    ADD COLUMN browser_version VARCHAR(50),
+    ADD COLUMN os_version VARCHAR(50),
+    ADD COLUMN device_type VARCHAR(20),
+    ADD COLUMN engine VARCHAR(50),
+    ADD COLUMN screen_width INT,
+    ADD COLUMN screen_height INT,
+    ADD COLUMN viewport_width INT,
+    ADD COLUMN viewport_height INT,
+    ADD COLUMN language VARCHAR(35),
+    ADD COLUMN timezone VARCHAR(50);
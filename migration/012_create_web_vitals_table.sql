@@ -0,0 +1,12 @@
+CREATE TABLE web_vitals (
+    id BIGSERIAL PRIMARY KEY,
+    session_id VARCHAR(100),
+    path VARCHAR(500) NOT NULL,
+    device_type VARCHAR(20) NOT NULL,
+    name VARCHAR(10) NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    time TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_web_vitals_time ON web_vitals (time);
+CREATE INDEX idx_web_vitals_path_name ON web_vitals (path, name);
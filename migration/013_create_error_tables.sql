@@ -0,0 +1,32 @@
+CREATE TABLE error_groups (
+    id BIGSERIAL PRIMARY KEY,
+    fingerprint CHAR(64) NOT NULL UNIQUE,
+    message TEXT NOT NULL,
+    source VARCHAR(500),
+    line INT,
+    col INT,
+    first_seen TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP NOT NULL,
+    count BIGINT NOT NULL DEFAULT 1
+);
+
+CREATE INDEX idx_error_groups_last_seen ON error_groups (last_seen);
+
+CREATE TABLE error_occurrences (
+    id BIGSERIAL PRIMARY KEY,
+    group_id BIGINT NOT NULL REFERENCES error_groups (id) ON DELETE CASCADE,
+    session_id VARCHAR(100),
+    path VARCHAR(500),
+    message TEXT NOT NULL,
+    stack TEXT,
+    source VARCHAR(500),
+    line INT,
+    col INT,
+    browser VARCHAR(50),
+    os VARCHAR(50),
+    country VARCHAR(50),
+    city VARCHAR(50),
+    time TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_error_occurrences_group_id_time ON error_occurrences (group_id, time);
@@ -0,0 +1,25 @@
+CREATE TABLE clicks (
+    id BIGSERIAL PRIMARY KEY,
+    session_id VARCHAR(100),
+    path VARCHAR(500) NOT NULL,
+    x REAL NOT NULL,
+    y REAL NOT NULL,
+    selector VARCHAR(500),
+    device_type VARCHAR(20) NOT NULL,
+    time TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_clicks_time ON clicks (time);
+CREATE INDEX idx_clicks_path_time ON clicks (path, time);
+
+CREATE TABLE scroll_depths (
+    id BIGSERIAL PRIMARY KEY,
+    session_id VARCHAR(100),
+    path VARCHAR(500) NOT NULL,
+    depth REAL NOT NULL,
+    device_type VARCHAR(20) NOT NULL,
+    time TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_scroll_depths_time ON scroll_depths (time);
+CREATE INDEX idx_scroll_depths_path_time ON scroll_depths (path, time);
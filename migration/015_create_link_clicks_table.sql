@@ -0,0 +1,12 @@
+CREATE TABLE link_clicks (
+    id BIGSERIAL PRIMARY KEY,
+    session_id VARCHAR(100) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    url VARCHAR(500) NOT NULL,
+    host VARCHAR(255) NOT NULL,
+    page VARCHAR(500),
+    time TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_link_clicks_kind_time ON link_clicks (kind, time);
+CREATE INDEX idx_link_clicks_session_id ON link_clicks (session_id);
@@ -0,0 +1,20 @@
+-- visits.timezone is the browser timezone, geo_timezone the one of the IP.
+ALTER TABLE visits
+    ADD COLUMN country_code CHAR(2),
+    ADD COLUMN region VARCHAR(100),
+    ADD COLUMN latitude DOUBLE PRECISION,
+    ADD COLUMN longitude DOUBLE PRECISION,
+    ADD COLUMN geo_timezone VARCHAR(50),
+    ADD COLUMN asn INTEGER,
+    ADD COLUMN isp VARCHAR(255);
+
+ALTER TABLE messages
+    ADD COLUMN country_code CHAR(2),
+    ADD COLUMN region VARCHAR(100),
+    ADD COLUMN latitude DOUBLE PRECISION,
+    ADD COLUMN longitude DOUBLE PRECISION,
+    ADD COLUMN geo_timezone VARCHAR(50),
+    ADD COLUMN asn INTEGER,
+    ADD COLUMN isp VARCHAR(255);
+
+CREATE INDEX idx_visits_asn ON visits (asn);
@@ -0,0 +1,5 @@
+-- With IP privacy enabled the stored value is a truncated address or a keyed
+-- hash, which does not fit INET.
+ALTER TABLE visits ALTER COLUMN ip TYPE VARCHAR(64) USING HOST(ip);
+
+ALTER TABLE messages ALTER COLUMN ip TYPE VARCHAR(64) USING HOST(ip);
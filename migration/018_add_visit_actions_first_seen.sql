@@ -0,0 +1,19 @@
+-- When an action was first taken in a session, used to order funnel steps.
+-- Earlier rows only tell that an action was reported by the end of the
+-- session, so that is when they are dated.
+ALTER TABLE visit_actions ADD COLUMN first_seen TIMESTAMP;
+
+UPDATE visit_actions a
+SET first_seen = COALESCE(s.ended_at, s.last_heartbeat_at)
+FROM sessions s
+WHERE s.session_id = a.session_id;
+
+UPDATE visit_actions a
+SET first_seen = v.start_time + COALESCE(v.duration, 0) * INTERVAL '1 second'
+FROM visits v
+WHERE v.session_id = a.session_id AND a.first_seen IS NULL;
+
+-- Actions of neither a session nor a visit are reachable by no report.
+DELETE FROM visit_actions WHERE first_seen IS NULL;
+
+ALTER TABLE visit_actions ALTER COLUMN first_seen SET NOT NULL;
@@ -0,0 +1,154 @@
+package location
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ramisoul84/emil-server/config"
+)
+
+// clientIPResolver finds the client address of a request. Forwarding headers
+// are only believed when the connection comes from a trusted proxy, and only
+// as far as the chain of trusted proxies goes.
+type clientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver trusts the proxies in cfg.Server.TrustedProxies, CIDRs
+// or single addresses. Entries that do not parse are skipped, validateConfig
+// rejects them at startup.
+func NewClientIPResolver(cfg *config.Config) *clientIPResolver {
+	r := &clientIPResolver{}
+	for _, entry := range cfg.Server.TrustedProxies {
+		if prefix, err := parsePrefix(entry); err == nil {
+			r.trusted = append(r.trusted, prefix)
+		}
+	}
+	return r
+}
+
+// parsePrefix parses a CIDR, or a single address as a one-address prefix.
+func parsePrefix(entry string) (netip.Prefix, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ClientIP returns the address of the client behind the trusted proxies.
+//
+// The hops of the Forwarded header (RFC 7239), or else X-Forwarded-For, are
+// walked from the right starting at the peer, and the first address that is
+// not a trusted proxy is the client. Without either header, a trusted peer
+// may name the client in X-Real-IP or CF-Connecting-IP.
+func (r *clientIPResolver) ClientIP(c *fiber.Ctx) string {
+	peer, ok := parseAddr(c.Context().RemoteIP().String())
+	if !ok {
+		return c.Context().RemoteIP().String()
+	}
+	if !r.isTrusted(peer) {
+		return peer.String()
+	}
+
+	hops, found := forwardedHops(c)
+	if !found {
+		hops, found = headerHops(c, "X-Forwarded-For")
+	}
+	if !found {
+		for _, header := range []string{"X-Real-IP", "CF-Connecting-IP"} {
+			if addr, ok := parseAddr(c.Get(header)); ok {
+				return addr.String()
+			}
+		}
+		return peer.String()
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(hops[i])
+		if !ok {
+			// The trusted proxy in front of a garbled hop is as far as we can see.
+			break
+		}
+		client = addr
+		if !r.isTrusted(addr) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+func (r *clientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHops returns the for= nodes of all Forwarded headers, in order.
+func forwardedHops(c *fiber.Ctx) ([]string, bool) {
+	values := c.Request().Header.PeekAll(fiber.HeaderForwarded)
+	if len(values) == 0 {
+		return nil, false
+	}
+
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(string(value), ",") {
+			node := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					node = strings.Trim(value, `"`)
+				}
+			}
+			hops = append(hops, node)
+		}
+	}
+
+	return hops, len(hops) > 0
+}
+
+// headerHops returns the comma-separated addresses of all headers named key, in order.
+func headerHops(c *fiber.Ctx, key string) ([]string, bool) {
+	var hops []string
+	for _, value := range c.Request().Header.PeekAll(key) {
+		for _, hop := range strings.Split(string(value), ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops, len(hops) > 0
+}
+
+// parseAddr parses an IPv4 or IPv6 address, optionally bracketed or with a
+// port as in Forwarded nodes. IPv4-mapped IPv6 addresses become IPv4.
+func parseAddr(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return netip.Addr{}, false
+	}
+
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	// Zones are meaningless past the local link.
+	return addr.WithZone("").Unmap(), true
+}
@@ -0,0 +1,186 @@
+package location
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ramisoul84/emil-server/config"
+	"github.com/valyala/fasthttp"
+)
+
+func TestClientIP(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			TrustedProxies: []string{"10.0.0.0/8", "2001:db8:ff::/48", "192.0.2.1"},
+		},
+	}
+	resolver := NewClientIPResolver(cfg)
+
+	tests := []struct {
+		name    string
+		peer    string
+		headers [][2]string
+		want    string
+	}{
+		{
+			name: "untrusted peer without headers",
+			peer: "203.0.113.7",
+			want: "203.0.113.7",
+		},
+		{
+			name:    "untrusted peer sending X-Forwarded-For",
+			peer:    "203.0.113.7",
+			headers: [][2]string{{"X-Forwarded-For", "198.51.100.1"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "untrusted peer sending Forwarded",
+			peer:    "203.0.113.7",
+			headers: [][2]string{{"Forwarded", "for=198.51.100.1"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "untrusted peer sending X-Real-IP",
+			peer:    "203.0.113.7",
+			headers: [][2]string{{"X-Real-IP", "198.51.100.1"}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "trusted peer with one hop",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"X-Forwarded-For", "198.51.100.1"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "trusted chain stops at the first untrusted hop",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"X-Forwarded-For", "1.1.1.1, 198.51.100.1, 192.0.2.1, 10.1.2.3"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "spoofed leftmost hop is ignored",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"X-Forwarded-For", "10.9.9.9, 198.51.100.1"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "only trusted hops",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"X-Forwarded-For", "10.0.0.2, 10.0.0.3"}},
+			want:    "10.0.0.2",
+		},
+		{
+			name: "several X-Forwarded-For headers",
+			peer: "10.0.0.1",
+			headers: [][2]string{
+				{"X-Forwarded-For", "198.51.100.1, 198.51.100.2"},
+				{"X-Forwarded-For", "10.0.0.5"},
+			},
+			want: "198.51.100.2",
+		},
+		{
+			name:    "garbled X-Forwarded-For hop",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"X-Forwarded-For", "198.51.100.1, not-an-ip, 10.0.0.2"}},
+			want:    "10.0.0.2",
+		},
+		{
+			name:    "Forwarded chain",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"Forwarded", "for=198.51.100.1;proto=https, for=192.0.2.1;by=10.0.0.1"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "Forwarded quoted IPv6 with port",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"Forwarded", `for="[2001:db8:cafe::17]:4711"`}},
+			want:    "2001:db8:cafe::17",
+		},
+		{
+			name:    "Forwarded IPv6 chain of trusted proxies",
+			peer:    "2001:db8:ff::1",
+			headers: [][2]string{{"Forwarded", `for="[2001:db8:cafe::17]:4711", for="[2001:db8:ff::2]"`}},
+			want:    "2001:db8:cafe::17",
+		},
+		{
+			name:    "Forwarded for=unknown",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"Forwarded", "for=198.51.100.1, for=unknown, for=10.0.0.2"}},
+			want:    "10.0.0.2",
+		},
+		{
+			name:    "Forwarded obfuscated node",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"Forwarded", `for=_hidden, for="_SEVKISEK"`}},
+			want:    "10.0.0.1",
+		},
+		{
+			name: "Forwarded wins over X-Forwarded-For",
+			peer: "10.0.0.1",
+			headers: [][2]string{
+				{"Forwarded", "for=198.51.100.1"},
+				{"X-Forwarded-For", "198.51.100.2"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name: "several Forwarded headers",
+			peer: "10.0.0.1",
+			headers: [][2]string{
+				{"Forwarded", "for=198.51.100.1"},
+				{"Forwarded", "for=192.0.2.1"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name:    "trusted peer with X-Real-IP",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"X-Real-IP", "198.51.100.1"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "trusted peer with CF-Connecting-IP",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"CF-Connecting-IP", "2001:db8:cafe::17"}},
+			want:    "2001:db8:cafe::17",
+		},
+		{
+			name:    "IPv4-mapped IPv6 peer",
+			peer:    "::ffff:10.0.0.1",
+			headers: [][2]string{{"X-Forwarded-For", "198.51.100.1"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "IPv4-mapped IPv6 hops",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"X-Forwarded-For", "::ffff:198.51.100.1, ::ffff:10.0.0.2"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "IPv4-mapped IPv6 in Forwarded",
+			peer:    "10.0.0.1",
+			headers: [][2]string{{"Forwarded", `for="[::ffff:198.51.100.1]:80"`}},
+			want:    "198.51.100.1",
+		},
+	}
+
+	app := fiber.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req fasthttp.Request
+			for _, header := range tt.headers {
+				req.Header.Add(header[0], header[1])
+			}
+
+			fctx := &fasthttp.RequestCtx{}
+			fctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(tt.peer), Port: 12345}, nil)
+			c := app.AcquireCtx(fctx)
+			defer app.ReleaseCtx(c)
+
+			if got := resolver.ClientIP(c); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
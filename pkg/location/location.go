@@ -1,12 +1,14 @@
 package location
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
-
-	"github.com/gofiber/fiber/v2"
 )
 
 type IPAPIResponse struct {
@@ -27,53 +29,90 @@ type IPAPIResponse struct {
 	Message     string  `json:"message"`
 }
 
-func GetFullClientInfo(ip string) (string, string) {
-	if ip == "" {
-		return "Unknown", "Unknown"
+// GeoInfo is the location and network of an IP address.
+type GeoInfo struct {
+	Country     string
+	CountryCode string // ISO 3166-1 alpha-2, e.g. "DE"
+	Region      string
+	City        string
+	Latitude    float64
+	Longitude   float64
+	Timezone    string // IANA name, e.g. "Europe/Berlin"
+	ASN         int    // autonomous system number, 0 when unknown
+	AS          string // e.g. "AS16509 Amazon.com, Inc."
+	ISP         string
+}
+
+// Unknown is the GeoInfo of an address no provider could resolve.
+func Unknown() GeoInfo {
+	return GeoInfo{Country: "Unknown", City: "Unknown"}
+}
+
+// ipAPI resolves locations with the ip-api.com JSON API. Its free tier is
+// HTTP only and rate limited, and it sees every address it is asked about.
+type ipAPI struct {
+	client *http.Client
+}
+
+func NewIPAPI() *ipAPI {
+	return &ipAPI{client: &http.Client{}}
+}
+
+func (p *ipAPI) Name() string {
+	return "ip-api"
+}
+
+func (p *ipAPI) Lookup(ctx context.Context, ip string) (GeoInfo, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://ip-api.com/json/"+url.PathEscape(ip), nil)
+	if err != nil {
+		return GeoInfo{}, false, err
 	}
 
-	resp, err := http.Get("http://ip-api.com/json/" + ip)
+	resp, err := p.client.Do(req)
 	if err != nil {
-		return "Unknown", "Unknown"
+		return GeoInfo{}, false, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return GeoInfo{}, false, fmt.Errorf("ip-api returned status %d", resp.StatusCode)
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "Unknown", "Unknown"
+		return GeoInfo{}, false, err
 	}
 
 	var result IPAPIResponse
 	if err := json.Unmarshal(body, &result); err != nil {
-		return "Unknown", "Unknown"
+		return GeoInfo{}, false, err
 	}
 
+	// Private and reserved addresses fail with a message, that is an answer.
 	if result.Status != "success" {
-		return "Unknown", "Unknown"
+		return GeoInfo{}, false, nil
 	}
 
-	return result.Country, result.City
+	return GeoInfo{
+		Country:     result.Country,
+		CountryCode: result.CountryCode,
+		Region:      result.RegionName,
+		City:        result.City,
+		Latitude:    result.Lat,
+		Longitude:   result.Lon,
+		Timezone:    result.Timezone,
+		ASN:         parseASN(result.AS),
+		AS:          result.AS,
+		ISP:         result.ISP,
+	}, true, nil
 }
 
-func GetRealClientIP(c *fiber.Ctx) string {
-	// Check X-Real-IP header (set by nginx)
-	if realIP := c.Get("X-Real-IP"); realIP != "" {
-		return realIP
-	}
-
-	// Check X-Forwarded-For header
-	if xff := c.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	// Check CF-Connecting-IP (Cloudflare)
-	if cfIP := c.Get("CF-Connecting-IP"); cfIP != "" {
-		return cfIP
+// parseASN extracts the number from an "AS<number> <name>" string.
+func parseASN(as string) int {
+	number, _, _ := strings.Cut(as, " ")
+	asn, err := strconv.Atoi(strings.TrimPrefix(number, "AS"))
+	if err != nil {
+		return 0
 	}
-
-	// Fallback to Fiber's IP method
-	return c.IP()
+	return asn
 }
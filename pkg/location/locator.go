@@ -0,0 +1,212 @@
+package location
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ramisoul84/emil-server/config"
+	"github.com/ramisoul84/emil-server/pkg/logger"
+)
+
+var (
+	geoCacheRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "geoip_cache_requests_total",
+			Help: "Total GeoIP cache lookups by result",
+		},
+		[]string{"result"},
+	)
+
+	geoLookupDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "geoip_lookup_duration_seconds",
+			Help:    "GeoIP provider lookup duration in seconds",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+		},
+		[]string{"provider", "result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		geoCacheRequestsTotal,
+		geoLookupDuration,
+	)
+}
+
+// Provider is a source of locations. It reports whether it knew the address,
+// and an error when it could not tell.
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, ip string) (GeoInfo, bool, error)
+}
+
+// locator asks its providers in order, each within its own timeout, and
+// caches the answers. Addresses no provider knows resolve to Unknown().
+type locator struct {
+	providers []Provider
+	timeout   time.Duration
+	cache     *lruCache
+	logger    logger.Logger
+}
+
+func NewLocator(cfg *config.Config, providers ...Provider) *locator {
+	return &locator{
+		providers: providers,
+		timeout:   cfg.GeoIP.LookupTimeout,
+		cache:     newLRUCache(cfg.GeoIP.CacheSize, cfg.GeoIP.CacheTTL),
+		logger:    logger.Get(),
+	}
+}
+
+func (l *locator) Lookup(ctx context.Context, ip string) GeoInfo {
+	if ip == "" {
+		return Unknown()
+	}
+
+	if info, ok := l.cache.get(ip); ok {
+		geoCacheRequestsTotal.WithLabelValues("hit").Inc()
+		return info
+	}
+	geoCacheRequestsTotal.WithLabelValues("miss").Inc()
+
+	failed := false
+	// network keeps the ASN a provider knew without knowing the location.
+	var network GeoInfo
+	for _, provider := range l.providers {
+		info, ok, err := l.lookup(ctx, provider, ip)
+		if err != nil {
+			failed = true
+			l.logger.Warn().Err(err).Str("provider", provider.Name()).Msg("GeoIP lookup failed")
+			continue
+		}
+		if ok {
+			info = withUnknown(withNetwork(info, network))
+			l.cache.add(ip, info)
+			return info
+		}
+		network = withNetwork(network, info)
+	}
+
+	info := withNetwork(Unknown(), network)
+
+	// Only cache that nobody knows the address when every provider answered.
+	if !failed {
+		l.cache.add(ip, info)
+	}
+
+	return info
+}
+
+func (l *locator) lookup(ctx context.Context, provider Provider, ip string) (GeoInfo, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	start := time.Now()
+	info, ok, err := provider.Lookup(ctx, ip)
+
+	result := "found"
+	switch {
+	case err != nil:
+		result = "error"
+	case !ok:
+		result = "not_found"
+	}
+	geoLookupDuration.WithLabelValues(provider.Name(), result).Observe(time.Since(start).Seconds())
+
+	return info, ok, err
+}
+
+// withUnknown fills the place names a provider left empty.
+func withUnknown(info GeoInfo) GeoInfo {
+	if info.Country == "" {
+		info.Country = "Unknown"
+	}
+	if info.City == "" {
+		info.City = "Unknown"
+	}
+	return info
+}
+
+// withNetwork fills the network of info from other when info has none.
+func withNetwork(info, other GeoInfo) GeoInfo {
+	if info.ASN == 0 && other.ASN != 0 {
+		info.ASN = other.ASN
+		info.AS = other.AS
+		info.ISP = other.ISP
+	}
+	return info
+}
+
+type cacheEntry struct {
+	ip      string
+	info    GeoInfo
+	expires time.Time
+}
+
+// lruCache keeps the most recently used lookups for at most ttl.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *lruCache) get(ip string) (GeoInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[ip]
+	if !ok {
+		return GeoInfo{}, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, ip)
+		return GeoInfo{}, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.info, true
+}
+
+func (c *lruCache) add(ip string, info GeoInfo) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if element, ok := c.entries[ip]; ok {
+		entry := element.Value.(*cacheEntry)
+		entry.info = info
+		entry.expires = expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[ip] = c.order.PushFront(&cacheEntry{ip: ip, info: info, expires: expires})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).ip)
+	}
+}
@@ -0,0 +1,201 @@
+package location
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/ramisoul84/emil-server/config"
+	"github.com/ramisoul84/emil-server/pkg/logger"
+)
+
+// mmdbRecord holds the fields we read from MaxMind GeoLite2/GeoIP2 and DB-IP
+// City and ASN databases, which share this layout.
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	ASN          uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// mmdbFile is a database file loaded into memory. It is reloaded when its
+// modification time or size change, so replacing the file in place is safe.
+type mmdbFile struct {
+	path    string
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+func openMMDBFile(path string) (*mmdbFile, error) {
+	f := &mmdbFile{path: path}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// reload reads the file again if it changed and reports whether it did.
+func (f *mmdbFile) reload() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", f.path, err)
+	}
+
+	f.mu.RLock()
+	unchanged := f.reader != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size
+	f.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	buf, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", f.path, err)
+	}
+	reader, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", f.path, err)
+	}
+
+	f.mu.Lock()
+	f.reader = reader
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	f.mu.Unlock()
+
+	return true, nil
+}
+
+func (f *mmdbFile) lookup(ip net.IP, record *mmdbRecord) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	_, ok, err := f.reader.LookupNetwork(ip, record)
+	return ok, err
+}
+
+// MMDB resolves locations from local MaxMind or DB-IP databases, without
+// sending visitor IPs anywhere.
+type MMDB struct {
+	city           *mmdbFile
+	asn            *mmdbFile
+	reloadInterval time.Duration
+	logger         logger.Logger
+}
+
+// NewMMDB opens the databases configured in cfg.GeoIP. It returns nil
+// without error when none is configured.
+func NewMMDB(cfg *config.Config) (*MMDB, error) {
+	if cfg.GeoIP.CityDBPath == "" && cfg.GeoIP.ASNDBPath == "" {
+		return nil, nil
+	}
+
+	db := &MMDB{
+		reloadInterval: cfg.GeoIP.ReloadInterval,
+		logger:         logger.Get(),
+	}
+
+	var err error
+	if cfg.GeoIP.CityDBPath != "" {
+		if db.city, err = openMMDBFile(cfg.GeoIP.CityDBPath); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.GeoIP.ASNDBPath != "" {
+		if db.asn, err = openMMDBFile(cfg.GeoIP.ASNDBPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+func (db *MMDB) Name() string {
+	return "mmdb"
+}
+
+// Lookup resolves ip and reports whether the city database knew it. A match
+// in the ASN database alone is returned too, but not reported as found, so
+// the next provider is still asked for the location.
+func (db *MMDB) Lookup(ctx context.Context, ip string) (GeoInfo, bool, error) {
+	var info GeoInfo
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return info, false, nil
+	}
+
+	found := false
+	if db.city != nil {
+		var record mmdbRecord
+		if ok, err := db.city.lookup(parsed, &record); err == nil && ok {
+			info.Country = record.Country.Names["en"]
+			info.CountryCode = record.Country.ISOCode
+			if len(record.Subdivisions) > 0 {
+				info.Region = record.Subdivisions[0].Names["en"]
+			}
+			info.City = record.City.Names["en"]
+			info.Latitude = record.Location.Latitude
+			info.Longitude = record.Location.Longitude
+			info.Timezone = record.Location.TimeZone
+			found = true
+		}
+	}
+	if db.asn != nil {
+		var record mmdbRecord
+		if ok, err := db.asn.lookup(parsed, &record); err == nil && ok && record.ASN != 0 {
+			info.ASN = int(record.ASN)
+			info.AS = fmt.Sprintf("AS%d %s", record.ASN, record.Organization)
+			info.ISP = record.Organization
+		}
+	}
+
+	return info, found, nil
+}
+
+// Watch reloads the databases when their files change, until ctx is done.
+// A file that fails to load keeps the previous version in use.
+func (db *MMDB) Watch(ctx context.Context) {
+	ticker := time.NewTicker(db.reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, f := range []*mmdbFile{db.city, db.asn} {
+				if f == nil {
+					continue
+				}
+				reloaded, err := f.reload()
+				if err != nil {
+					db.logger.Error().Err(err).Str("path", f.path).Msg("Failed to reload GeoIP database")
+					continue
+				}
+				if reloaded {
+					db.logger.Info().Str("path", f.path).Msg("GeoIP database reloaded")
+				}
+			}
+		}
+	}
+}
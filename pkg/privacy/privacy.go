@@ -0,0 +1,117 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/ramisoul84/emil-server/config"
+)
+
+// IP privacy modes
+const (
+	// ModeFull stores IPs as they are.
+	ModeFull = "full"
+	// ModeTruncate zeroes the host part: IPv4 to /24, IPv6 to /48.
+	ModeTruncate = "truncate"
+	// ModeHash replaces IPs with a keyed hash whose salt is derived from the
+	// key and the UTC date, so a visitor can be recognized within a day, on
+	// every replica and across restarts, but not across days.
+	ModeHash = "hash"
+)
+
+const (
+	truncateBitsV4 = 24
+	truncateBitsV6 = 48
+	keySize        = 32
+	// hashLength is the number of hex characters of a hashed IP that are kept.
+	hashLength = 32
+)
+
+// Anonymizer turns client IPs into what may be persisted or logged. Lookups
+// that need the full address, like geolocation, must happen before.
+type Anonymizer struct {
+	mode string
+	key  []byte
+
+	mu      sync.Mutex
+	saltDay string
+	salt    []byte
+}
+
+func NewAnonymizer(cfg *config.Config) *Anonymizer {
+	return &Anonymizer{
+		mode: cfg.Privacy.IPMode,
+		key:  []byte(cfg.Privacy.IPHashKey),
+	}
+}
+
+// NewEphemeralAnonymizer hashes with a random key instead of the configured
+// one. The key is never stored, so its hashes cannot be linked to any other.
+func NewEphemeralAnonymizer(cfg *config.Config) *Anonymizer {
+	key := make([]byte, keySize)
+	// crypto/rand.Read does not fail on supported platforms.
+	rand.Read(key)
+
+	return &Anonymizer{
+		mode: cfg.Privacy.IPMode,
+		key:  key,
+	}
+}
+
+// Anonymize returns ip as it may be stored. Values that are not IP addresses,
+// such as already hashed ones, are returned as is.
+func (a *Anonymizer) Anonymize(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+
+	switch a.mode {
+	case ModeTruncate:
+		return Truncate(addr).String()
+	case ModeHash:
+		return a.hash(addr)
+	default:
+		return ip
+	}
+}
+
+// Truncate keeps the network part of addr.
+func Truncate(addr netip.Addr) netip.Addr {
+	bits := truncateBitsV6
+	if addr.Is4() {
+		bits = truncateBitsV4
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.Addr()
+}
+
+func (a *Anonymizer) hash(addr netip.Addr) string {
+	mac := hmac.New(sha256.New, a.currentSalt())
+	mac.Write(addr.AsSlice())
+
+	return hex.EncodeToString(mac.Sum(nil))[:hashLength]
+}
+
+// currentSalt returns the salt of the current UTC day, the HMAC of the date
+// under the key. It is derived once per day.
+func (a *Anonymizer) currentSalt() []byte {
+	day := time.Now().UTC().Format(time.DateOnly)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.saltDay != day {
+		mac := hmac.New(sha256.New, a.key)
+		mac.Write([]byte(day))
+		a.salt, a.saltDay = mac.Sum(nil), day
+	}
+
+	return a.salt
+}
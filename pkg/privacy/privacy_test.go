@@ -0,0 +1,100 @@
+package privacy
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/ramisoul84/emil-server/config"
+)
+
+func newTestAnonymizer(mode, key string) *Anonymizer {
+	return NewAnonymizer(&config.Config{
+		Privacy: config.PrivacyConfig{IPMode: mode, IPHashKey: key},
+	})
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{name: "IPv4 to /24", ip: "203.0.113.77", want: "203.0.113.0"},
+		{name: "IPv4 network address", ip: "203.0.113.0", want: "203.0.113.0"},
+		{name: "IPv6 to /48", ip: "2001:db8:cafe:1234::17", want: "2001:db8:cafe::"},
+		{name: "IPv6 loopback", ip: "::1", want: "::"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Truncate(netip.MustParseAddr(tt.ip)).String(); got != tt.want {
+				t.Errorf("Truncate(%s) = %s, want %s", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnonymizeTruncate(t *testing.T) {
+	a := newTestAnonymizer(ModeTruncate, "")
+
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{name: "IPv4", ip: "203.0.113.77", want: "203.0.113.0"},
+		{name: "IPv6", ip: "2001:db8:cafe:1234::17", want: "2001:db8:cafe::"},
+		{name: "IPv4-mapped IPv6 is truncated as IPv4", ip: "::ffff:203.0.113.77", want: "203.0.113.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.Anonymize(tt.ip); got != tt.want {
+				t.Errorf("Anonymize(%q) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnonymizeNonIP(t *testing.T) {
+	inputs := []string{
+		"",
+		"not-an-ip",
+		"203.0.113",
+		"203.0.113.7:443",
+		"6f1ed002ab5595859014ebf0951522d9",
+	}
+
+	for _, mode := range []string{ModeFull, ModeTruncate, ModeHash} {
+		a := newTestAnonymizer(mode, "secret")
+		for _, input := range inputs {
+			if got := a.Anonymize(input); got != input {
+				t.Errorf("%s: Anonymize(%q) = %q, want it unchanged", mode, input, got)
+			}
+		}
+	}
+}
+
+func TestAnonymizeHash(t *testing.T) {
+	a := newTestAnonymizer(ModeHash, "secret")
+
+	hashed := a.Anonymize("203.0.113.77")
+	if len(hashed) != hashLength || hashed == "203.0.113.77" {
+		t.Fatalf("Anonymize() = %q, want a %d character hash", hashed, hashLength)
+	}
+	if got := a.Anonymize(hashed); got != hashed {
+		t.Errorf("Anonymize(%q) = %q, want a hash to be kept", hashed, got)
+	}
+	if got := a.Anonymize("::ffff:203.0.113.77"); got != hashed {
+		t.Errorf("IPv4-mapped IPv6 hashed to %q, want %q", got, hashed)
+	}
+	if got := newTestAnonymizer(ModeHash, "secret").Anonymize("203.0.113.77"); got != hashed {
+		t.Errorf("another anonymizer with the same key hashed to %q, want %q", got, hashed)
+	}
+	if got := newTestAnonymizer(ModeHash, "other").Anonymize("203.0.113.77"); got == hashed {
+		t.Errorf("an anonymizer with another key hashed to the same %q", got)
+	}
+	if got := a.Anonymize("203.0.113.78"); got == hashed {
+		t.Errorf("another IP hashed to the same %q", got)
+	}
+}